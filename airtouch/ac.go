@@ -1,8 +1,8 @@
 package airtouch
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"strconv"
 
 	"github.com/elliotchance/orderedmap"
@@ -10,7 +10,10 @@ import (
 
 // AC models AC attributes.
 type AC struct {
+	// PowerState is either On or Off.
+	PowerState       string
 	AcMode           string
+	AcFanSpeed       string
 	AcTargetSetpoint int
 	Temperature      float64
 	Spill            bool
@@ -41,6 +44,21 @@ func (a *AirTouch) ACModeMap() map[string]string {
 	return m
 }
 
+// ACFanSpeedMap maps stringy AC fan speeds to their numerical value.
+func (a *AirTouch) ACFanSpeedMap() map[string]string {
+	m := make(map[string]string)
+
+	m["Auto"] = "0"
+	m["Quiet"] = "1"
+	m["Low"] = "2"
+	m["Medium"] = "3"
+	m["High"] = "4"
+	m["Powerful"] = "5"
+	m["Turbo"] = "6"
+
+	return m
+}
+
 // ACStatusMap is used to find the corresponding attribute from the reply message.
 func (a *AirTouch) ACStatusMap() map[string]string {
 	m := make(map[string]string)
@@ -86,17 +104,29 @@ func (a *AirTouch) ACControlMap() *orderedmap.OrderedMap {
 	return m
 }
 
-// GetACData retrieves AC data and sends to configured outputs.
+// GetACData retrieves AC data and sends to configured outputs. When CacheMaxAge is set, a
+// recent enough snapshot is served without querying the console.
 func (a *AirTouch) GetACData() error {
+	_, err := a.cached(cacheAC, a.getACData)
+	return err
+}
+
+// ACData refreshes the AC like GetACData and returns a copy of it. Unlike AC, the copy is safe to
+// read while other goroutines refresh the AC.
+func (a *AirTouch) ACData() (AC, error) {
+	entry, err := a.cached(cacheAC, a.getACData)
+	return entry.ac, err
+}
+
+func (a *AirTouch) getACData() (cacheEntry, error) {
 	err := a.GetACStatus()
 	if err != nil {
-		return err
+		return cacheEntry{}, err
 	}
 
-	log.Printf("AC Temperature: %.1f", a.AC.Temperature)
-	log.Printf("AC TargetSetpoint: %d", a.AC.AcTargetSetpoint)
+	a.logger().Info("AC data", "ac", a.AC)
 
-	return nil
+	return cacheEntry{ac: a.AC}, nil
 }
 
 // GetACStatus sends and decodes the ACStatus reply.
@@ -118,39 +148,66 @@ func (a *AirTouch) GetACStatus() error {
 	return nil
 }
 
-func (a *AirTouch) SetGroupToTemperature(groupNumber string, temperature string) error {
-	controlMessage := a.GroupControlMap()
-	controlMessage.Set("Power", "3")
-	controlMessage.Set("HaveTemperatureControl", "3")
-	controlMessage.Set("GroupSettingValue", "5") // Temperature rather than percentage
-	controlMessage.Set("TargetSetpoint", temperature)
-	controlMessage.Set("GroupNumber", groupNumber)
-	controlMessage.Set("ZeroedByte", "0")
+// SetGroupToTemperature turns a group, by number, name or alias, on under temperature control at
+// the given setpoint.
+func (a *AirTouch) SetGroupToTemperature(group string, temperature string) error {
+	return a.SetGroups([]GroupChange{{Group: group, Power: "On", TargetSetpoint: temperature}})
+}
+
+// ACChange is a change to the AC. Empty fields are left as they are.
+type ACChange struct {
+	// Power is On or Off.
+	Power string
+	// Mode is one of the ACModeMap modes.
+	Mode string
+	// FanSpeed is one of the ACFanSpeedMap speeds.
+	FanSpeed string
+	// TargetSetpoint is in degrees.
+	TargetSetpoint string
+}
+
+// SetACState adjusts the ACControlMap to set the desired AC power and operating mode.
+func (a *AirTouch) SetACState(powerState string, modeState string) error {
+	if _, ok := a.ACPowerMap()[powerState]; !ok {
+		return &ValidationError{Field: "Power", Value: powerState, Reason: "unknown power state"}
+	}
 
-	message, err := a.MessageObjectToMessagePacket(GroupControl, controlMessage)
+	if _, ok := a.ACModeMap()[modeState]; !ok {
+		return &ValidationError{Field: "AcMode", Value: modeState, Reason: "unknown mode"}
+	}
+
+	return a.SetAC(ACChange{Power: powerState, Mode: modeState})
+}
+
+// SetAC sends an AC change in a single ACControl message and decodes the AC status reply.
+// Fields that are not set are sent as keep values so the console leaves them alone.
+func (a *AirTouch) SetAC(change ACChange) error {
+	err := a.validateACChange(change)
 	if err != nil {
 		return err
 	}
 
-	messageIn := MessageInput{
-		Message: *message,
+	// The compressor guard compares against the state the AC ends up in.
+	powerState := change.Power
+	if powerState == "" {
+		powerState = a.AC.PowerState
 	}
 
-	messageOut, err := a.CommunicateMessage(&messageIn)
+	modeState := change.Mode
+	if modeState == "" {
+		modeState = a.AC.AcMode
+	}
+
+	err = a.checkCompressorGuard(powerState, modeState)
 	if err != nil {
 		return err
 	}
 
-	err = a.DecodeGroupStatusMessage(*messageOut)
+	err = a.validateConfirmation()
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-// SetCoolingModeForAC adjusts the ACControlMap to set the desired AC operating mode.
-func (a *AirTouch) SetACState(powerState string, modeState string) error {
 	controlMessage := a.ACControlMap()
 	controlMessage.Set("Power", "0")
 	controlMessage.Set("AcNumber", "0")
@@ -161,12 +218,28 @@ func (a *AirTouch) SetACState(powerState string, modeState string) error {
 	controlMessage.Set("ZeroedByte", "0")
 
 	// These are required to leave these settings unchanged.
-	controlMessage.Set("Power", a.ACPowerMap()[powerState])
-	controlMessage.Set("AcMode", a.ACModeMap()[modeState])
+	controlMessage.Set("AcMode", "15")
 	controlMessage.Set("AcFanSpeed", "15")
 	controlMessage.Set("TargetSetpoint", "63")
 	controlMessage.Set("AcNumber", "0")
 
+	if change.Power != "" {
+		controlMessage.Set("Power", a.ACPowerMap()[change.Power])
+	}
+
+	if change.Mode != "" {
+		controlMessage.Set("AcMode", a.ACModeMap()[change.Mode])
+	}
+
+	if change.FanSpeed != "" {
+		controlMessage.Set("AcFanSpeed", a.ACFanSpeedMap()[change.FanSpeed])
+	}
+
+	if change.TargetSetpoint != "" {
+		controlMessage.Set("SetpointControlType", "1") // Set value rather than increase or decrease.
+		controlMessage.Set("TargetSetpoint", change.TargetSetpoint)
+	}
+
 	message, err := a.MessageObjectToMessagePacket(ACControl, controlMessage)
 	if err != nil {
 		return err
@@ -176,8 +249,13 @@ func (a *AirTouch) SetACState(powerState string, modeState string) error {
 		Message: *message,
 	}
 
-	messageOut, err := a.CommunicateMessage(&messageIn)
-	if err != nil {
+	a.recordACCommands(change)
+
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+
+	messageOut, err := a.CommunicateControlMessage("ACControl", &messageIn, ACStatusType, change.logValues()...)
+	if err != nil || messageOut == nil {
 		return err
 	}
 
@@ -186,12 +264,107 @@ func (a *AirTouch) SetACState(powerState string, modeState string) error {
 		return err
 	}
 
+	return a.confirm(func() error {
+		return a.checkACChange(change)
+	}, a.GetACStatus)
+}
+
+// validateACChange checks every field of an AC change before anything is sent.
+func (a *AirTouch) validateACChange(change ACChange) error {
+	if change == (ACChange{}) {
+		return &ValidationError{Field: "ACChange", Reason: "no changes"}
+	}
+
+	if _, ok := a.ACPowerMap()[change.Power]; change.Power != "" && !ok {
+		return &ValidationError{Field: "Power", Value: change.Power, Reason: "unknown power state"}
+	}
+
+	if _, ok := a.ACModeMap()[change.Mode]; change.Mode != "" && !ok {
+		return &ValidationError{Field: "AcMode", Value: change.Mode, Reason: "unknown mode"}
+	}
+
+	if change.Mode != "" {
+		err := a.validateACMode(change.Mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, ok := a.ACFanSpeedMap()[change.FanSpeed]; change.FanSpeed != "" && !ok {
+		return &ValidationError{Field: "AcFanSpeed", Value: change.FanSpeed, Reason: "unknown fan speed"}
+	}
+
+	if change.TargetSetpoint != "" {
+		setpoint, err := strconv.Atoi(change.TargetSetpoint)
+		if err != nil {
+			return &ValidationError{Field: "TargetSetpoint", Value: change.TargetSetpoint, Reason: "not a number"}
+		}
+
+		mode := change.Mode
+		if mode == "" {
+			mode = a.AC.AcMode
+		}
+
+		minSetpoint, maxSetpoint := a.capabilities().setpointRange(mode)
+		if setpoint < minSetpoint || setpoint > maxSetpoint {
+			return &ValidationError{Field: "TargetSetpoint", Value: change.TargetSetpoint, Reason: fmt.Sprintf("outside %d-%d", minSetpoint, maxSetpoint)}
+		}
+	}
+
 	return nil
 }
 
+// logValues describes the fields an AC change sets for logging.
+func (c ACChange) logValues() []any {
+	var values []any
+
+	if c.Power != "" {
+		values = append(values, "power", c.Power)
+	}
+
+	if c.Mode != "" {
+		values = append(values, "mode", c.Mode)
+	}
+
+	if c.FanSpeed != "" {
+		values = append(values, "fan_speed", c.FanSpeed)
+	}
+
+	if c.TargetSetpoint != "" {
+		values = append(values, "target_setpoint", c.TargetSetpoint)
+	}
+
+	return values
+}
+
 // MessageObjectToMessagePacket transforms our object to a string we can then send to the AC.
 func (a *AirTouch) MessageObjectToMessagePacket(messageType string, messageObject *orderedmap.OrderedMap) (*string, error) {
-	messageString := "80b001" + messageType
+	return a.MessageObjectsToMessagePacket(messageType, []*orderedmap.OrderedMap{messageObject})
+}
+
+// MessageObjectsToMessagePacket transforms several objects into a single message whose data is
+// each object's payload in turn. GroupControl messages use this to change many groups at once.
+func (a *AirTouch) MessageObjectsToMessagePacket(messageType string, messageObjects []*orderedmap.OrderedMap) (*string, error) {
+	dataPayload := ""
+
+	for _, messageObject := range messageObjects {
+		payload, err := a.messageObjectToPayload(messageType, messageObject)
+		if err != nil {
+			return nil, err
+		}
+		dataPayload += payload
+	}
+
+	dataLength := len(dataPayload) / 2
+	messageString := "80b001" + messageType + fmt.Sprintf("%04x", dataLength) + dataPayload
+
+	a.trace("built control message", "type", messageType, "entries", len(messageObjects), "message", messageString)
+
+	return &messageString, nil
+}
+
+// messageObjectToPayload encodes a single object into hex using the location map for messageType.
+func (a *AirTouch) messageObjectToPayload(messageType string, messageObject *orderedmap.OrderedMap) (string, error) {
 	binaryMessagePayloadString := ""
 	var packetLocationMap *orderedmap.OrderedMap
 
@@ -202,46 +375,36 @@ func (a *AirTouch) MessageObjectToMessagePacket(messageType string, messageObjec
 	}
 
 	for _, k := range packetLocationMap.Keys() {
-		//a.Log.Debug("Value is = %s", l)
-		//a.Log.Debug("Key is = %s", k)
 		value, _ := packetLocationMap.Get(k)
 		valueAsString := value.(string)
 
-		messageValue, _ := messageObject.Get(k)
-		messageValueAsString := messageValue.(string)
+		messageValue, ok := messageObject.Get(k)
+		if !ok {
+			return "", &ValidationError{Field: k.(string), Reason: "missing from control message"}
+		}
+
+		messageValueAsString, ok := messageValue.(string)
+		if !ok {
+			return "", &ValidationError{Field: k.(string), Value: fmt.Sprint(messageValue), Reason: "not a string"}
+		}
 
 		binValue, err := a.AddMapValueToBinaryValue(binaryMessagePayloadString, valueAsString, messageValueAsString)
 		if err != nil {
-			return nil, err
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				validationErr.Field = k.(string)
+			}
+			return "", err
 		}
 		binaryMessagePayloadString = *binValue
 	}
 
-	//a.Log.Debug("dataPayloadBinary: %s", binaryMessagePayloadString)
-
 	binaryMessagePayloadBase2, err := strconv.ParseInt(binaryMessagePayloadString, 2, 64)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	//a.Log.Debug("binaryMessagePayloadBase2: %d", binaryMessagePayloadBase2)
-
-	dataPayload := fmt.Sprintf("%08x", binaryMessagePayloadBase2)
-	//a.Log.Debug("binaryMessagePayloadHex: %s", dataPayload)
-
-	dataLength := len(dataPayload) / 2
-	lenA := len(fmt.Sprintf("%x", dataLength))
-	//a.Log.Debug("lenA: %d", lenA)
-	lenB := fmt.Sprintf("%x", dataLength)
-	//a.Log.Debug("lenB: %s", lenB)
-	lengthString := "0000"[0:4-(lenA)] + lenB
-	//a.Log.Debug("lengthString: %s", lengthString)
-
-	messageString += lengthString + dataPayload
-	//a.Log.Debug("messageString: %s", messageString)
 
-	return &messageString, nil
+	a.trace("encoded control entry", "type", messageType, "payload_binary", binaryMessagePayloadString)
 
-	// messageIn := MessageInput{
-	// 	Message: SetCoolingModeForAC,
-	// }
+	return fmt.Sprintf("%08x", binaryMessagePayloadBase2), nil
 }
@@ -1,6 +1,13 @@
 package airtouch
 
-import "testing"
+import (
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"testing/quick"
+
+	"github.com/elliotchance/orderedmap"
+)
 
 func TestAC(t *testing.T) {
 	data := 1
@@ -10,3 +17,86 @@ func TestAC(t *testing.T) {
 		t.Errorf("expected %d, got %d", expected, data)
 	}
 }
+
+// roundTrip encodes values with the given location map and decodes every field back out of the
+// resulting frame, returning false if any field does not survive.
+func roundTrip(t *testing.T, messageType string, locations *orderedmap.OrderedMap, values []uint8) bool {
+	a := AirTouch{}
+	controlMessage := orderedmap.NewOrderedMap()
+	expected := make(map[string]int64)
+
+	for i, k := range locations.Keys() {
+		location, _ := locations.Get(k)
+		_, lowerValue, upperValue, err := parseLocation(location.(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		value := int64(values[i]) & (1<<(upperValue-lowerValue+1) - 1)
+		expected[k.(string)] = value
+		controlMessage.Set(k, strconv.FormatInt(value, 10))
+	}
+
+	message, err := a.MessageObjectToMessagePacket(messageType, controlMessage)
+	if err != nil {
+		t.Error(err)
+		return false
+	}
+
+	frame, err := hex.DecodeString(*message)
+	if err != nil {
+		t.Error(err)
+		return false
+	}
+
+	// Skip address, message ID, message type and data length.
+	data := frame[6:]
+
+	for _, k := range locations.Keys() {
+		location, _ := locations.Get(k)
+		value, err := a.TranslateMapValueToValue(data, location.(string))
+		if err != nil {
+			t.Error(err)
+			return false
+		}
+
+		if *value != expected[k.(string)] {
+			t.Errorf("%s: expected %d, got %d", k, expected[k.(string)], *value)
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestACControlRoundTrip(t *testing.T) {
+	a := AirTouch{}
+	property := func(values [7]uint8) bool {
+		return roundTrip(t, ACControl, a.ACControlMap(), values[:])
+	}
+
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGroupControlRoundTrip(t *testing.T) {
+	a := AirTouch{}
+	property := func(values [6]uint8) bool {
+		return roundTrip(t, GroupControl, a.GroupControlMap(), values[:])
+	}
+
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAddMapValueToBinaryValueOverflow(t *testing.T) {
+	a := AirTouch{}
+
+	for _, value := range []string{"4", "-1", "x"} {
+		if _, err := a.AddMapValueToBinaryValue("", "1:7-8", value); err == nil {
+			t.Errorf("expected an error encoding %s into 2 bits", value)
+		}
+	}
+}
@@ -1,5 +1,13 @@
 package airtouch
 
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
 // AirTouch models AC and groups.
 type AirTouch struct {
 	IPAddress        string
@@ -7,8 +15,102 @@ type AirTouch struct {
 	RootTempDir      string
 	Timezone         string
 	ReportLoopPeriod int
-	AC               AC
-	Groups           []Group
+	// Log receives client logs. Set its level to LevelTrace to hex dump protocol frames.
+	// Defaults to slog.Default() when nil.
+	Log *slog.Logger
+	// Confirmation is how control messages are checked against the resulting state, one of
+	// ConfirmReply, ConfirmReplyAndPoll or ConfirmNone. Defaults to ConfirmReply.
+	Confirmation string
+	// GroupAliases maps extra names to a group name or number, e.g. "kids" to "Bed 2".
+	GroupAliases map[string]string
+	// CacheMaxAge lets GetGroupData and GetACData serve snapshots younger than this without
+	// querying the console. Zero disables the cache.
+	CacheMaxAge time.Duration
+	// DryRun logs control messages and the state change they would make instead of sending
+	// them. Queries are still sent.
+	DryRun bool
+	// Capabilities limits the setpoints, groups and modes control messages may use. GetACAbility
+	// fills it from the console. When nil, DefaultCapabilities is used.
+	Capabilities *Capabilities
+	// CompressorMinOnTime and CompressorMinOffTime stop SetACState from stopping the compressor
+	// sooner than CompressorMinOnTime after it started, or starting it sooner than
+	// CompressorMinOffTime after it stopped. The times are kept in RootTempDir. Zero disables
+	// a guard.
+	CompressorMinOnTime  time.Duration
+	CompressorMinOffTime time.Duration
+	// PatchConfigFile is a JSON PatchConfig that is reloaded whenever it changes.
+	PatchConfigFile string
+	// Latitude and Longitude locate the house for schedule entries relative to the sun, in
+	// degrees north and east.
+	Latitude  float64
+	Longitude float64
+	// ManualHold pauses automations on the AC or a group for this long after a change this
+	// client didn't command, such as one made on the wall panel. Zero disables detection.
+	ManualHold time.Duration
+	// FocusStrategies adds to the focus strategies a PatchConfig can select by name.
+	FocusStrategies map[string]FocusStrategy
+	AC              AC
+	Groups          []Group
+
+	// groupNames caches the group name table by group number.
+	groupNames map[int]string
+
+	subscribersMu  sync.Mutex
+	subscribers    map[int]func(Event)
+	nextSubscriber int
+
+	cacheMu       sync.Mutex
+	cacheEntries  map[string]cacheEntry
+	cacheInFlight map[string]*refresh
+	// cacheGeneration is incremented by InvalidateCache.
+	cacheGeneration int
+
+	// stateMu serialises the fetches and control replies that decode into AC and Groups.
+	stateMu sync.Mutex
+
+	// patchMu guards the patch config set by SetPatchConfig or loaded from PatchConfigFile.
+	patchMu            sync.Mutex
+	patchConfig        *PatchConfig
+	patchConfigModTime time.Time
+
+	// manualMu guards the command log, the pauses it detects and the state they are kept with.
+	manualMu     sync.Mutex
+	manual       manualState
+	manualLoaded bool
+
+	// now replaces time.Now in tests.
+	now func() time.Time
+}
+
+// CommunicateControlMessage sends a control message and checks that the reply is of replyType.
+// change describes the intended state change for logging. In DryRun the message is logged
+// instead of sent and a nil reply is returned.
+func (a *AirTouch) CommunicateControlMessage(command string, message *MessageInput, replyType byte, change ...any) (*MessageOutput, error) {
+	if a.DryRun {
+		err := a.PrepareMessage(message)
+		if err != nil {
+			return nil, err
+		}
+
+		a.logger().Info("dry run, not sending control message", append([]any{"command", command, "frame", message.MessageWithCRC}, change...)...)
+
+		return nil, nil
+	}
+
+	defer a.InvalidateCache()
+
+	a.logger().Debug("sending control message", append([]any{"command", command}, change...)...)
+
+	messageOut, err := a.CommunicateMessage(message)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(messageOut.Type, []byte{replyType}) {
+		return nil, &RejectedError{Command: command, Reason: fmt.Sprintf("unexpected reply type %x", messageOut.Type)}
+	}
+
+	return messageOut, nil
 }
 
 // CommunicateMessage takes a message and translates the return reply.
@@ -18,15 +120,11 @@ func (a *AirTouch) CommunicateMessage(message *MessageInput) (*MessageOutput, er
 		return nil, err
 	}
 
-	//a.Log.Debug("Message: %s", message.MessageWithCRC)
-
 	responseBytes, err := a.SendMessage(&message.MessageWithCRC)
 	if err != nil {
 		return nil, err
 	}
 
-	//a.Log.Debug("Response: %s", responseBytes)
-
 	messageOut, err := a.TranslatePacketToMessage(responseBytes)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,83 @@
+package airtouch
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeConsole listens on a local port and answers each request with the frame returned by reply.
+// It returns an AirTouch pointed at the listener.
+func fakeConsole(t *testing.T, reply func(request []byte) []byte) *AirTouch {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			request := make([]byte, 1024)
+			read, err := conn.Read(request)
+			if err == nil {
+				conn.Write(reply(request[:read]))
+			}
+			conn.Close()
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+
+	return &AirTouch{IPAddress: addr.IP.String(), Port: addr.Port}
+}
+
+func TestDryRun(t *testing.T) {
+	var requests []byte
+	a := fakeConsole(t, func(request []byte) []byte {
+		requests = append(requests, request[5])
+		if request[5] == 0x1f {
+			return replyFrame(0x1f, groupNameSeed)
+		}
+		return acStatusReply
+	})
+
+	var logs bytes.Buffer
+	a.Log = slog.New(slog.NewTextHandler(&logs, nil))
+	a.DryRun = true
+
+	if err := a.SetACState("On", "Heat"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.SetGroups([]GroupChange{{Group: "Bed", TargetSetpoint: "20"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Queries, such as resolving the group name, still go to the console.
+	if err := a.GetACData(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(requests, []byte{0x1f, 0x2d}) {
+		t.Errorf("expected only the name and status queries to be sent, got %x", requests)
+	}
+
+	for _, expected := range []string{
+		"command=ACControl frame=555580b0012c0004",
+		"command=GroupControl frame=555580b0012a0004",
+		"mode=Heat",
+	} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Errorf("expected %q in %q", expected, logs.String())
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package airtouch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	awayFile      = "away.json"
+	rampRatesFile = "ramp_rates.json"
+
+	// rampSamplePeriod is how far apart the samples ramp rates are learned from are. Shorter
+	// periods are dominated by the 0.1 degree sensor resolution.
+	rampSamplePeriod = 10 * time.Minute
+	// rampSmoothing is the weight a new sample has in a learned ramp rate.
+	rampSmoothing = 0.2
+)
+
+// AwayState is the configuration stored while the house is away, and when it is restored.
+type AwayState struct {
+	Snapshot Snapshot  `json:"snapshot"`
+	Started  time.Time `json:"started"`
+	Return   time.Time `json:"return"`
+}
+
+// RampRates are how fast groups approach their setpoint, in degrees an hour, by group number.
+type RampRates struct {
+	Cool map[int]float64 `json:"cool"`
+	Heat map[int]float64 `json:"heat"`
+}
+
+// AwayMode sets the house back while it is empty and restores it in time for the return. The
+// stored configuration and learned ramp rates are kept in RootTempDir so they survive restarts.
+type AwayMode struct {
+	AirTouch *AirTouch
+	// Interval is how often Run checks whether to restore and samples the ramp rates. Defaults
+	// to a minute.
+	Interval time.Duration
+	// DefaultRampRate is used for groups without a learned ramp rate, in degrees an hour.
+	// Defaults to 2.
+	DefaultRampRate float64
+	// MaxPreconditioning caps how long before the return the configuration is restored.
+	// Defaults to 3 hours.
+	MaxPreconditioning time.Duration
+
+	mu     sync.Mutex
+	sample *Snapshot
+	now    func() time.Time
+}
+
+// Start stores the current configuration, applies setback and restores the configuration in
+// time for the house to reach its setpoints at returnAt. setback is typically the AC Off, or
+// groups at wide setpoints.
+func (m *AwayMode) Start(returnAt time.Time, setback DesiredState) error {
+	a := m.AirTouch
+
+	if _, away := m.State(); away {
+		return &ValidationError{Field: "Away", Value: "true", Reason: "already away"}
+	}
+
+	if _, ok := a.ACPowerMap()[setback.ACPower]; setback.ACPower != "" && !ok {
+		return &ValidationError{Field: "ACPower", Value: setback.ACPower, Reason: "unknown power state"}
+	}
+
+	if _, ok := a.ACModeMap()[setback.ACMode]; setback.ACMode != "" && !ok {
+		return &ValidationError{Field: "ACMode", Value: setback.ACMode, Reason: "unknown mode"}
+	}
+
+	err := a.GetGroupData()
+	if err != nil {
+		return err
+	}
+
+	err = a.GetACData()
+	if err != nil {
+		return err
+	}
+
+	state := AwayState{Snapshot: a.Snapshot(), Started: m.clock(), Return: returnAt}
+
+	// The configuration is stored before the setback is sent so that it is never lost.
+	err = m.save(&state)
+	if err != nil {
+		return err
+	}
+
+	a.logger().Info("away", "return", returnAt)
+
+	r := Reconciler{AirTouch: a}
+	r.SetDesired(setback)
+	_, err = r.Reconcile()
+
+	return err
+}
+
+// State returns the stored configuration if the house is away.
+func (m *AwayMode) State() (AwayState, bool) {
+	var state AwayState
+
+	value, err := m.AirTouch.ReadStringFromFile(awayFile)
+	if err != nil {
+		return state, false
+	}
+
+	err = json.Unmarshal([]byte(value), &state)
+	if err != nil {
+		m.AirTouch.logger().Warn("ignoring unreadable away state", "error", err)
+		return AwayState{}, false
+	}
+
+	return state, true
+}
+
+// Return restores the stored configuration now and ends away mode.
+func (m *AwayMode) Return() error {
+	state, away := m.State()
+	if !away {
+		return nil
+	}
+
+	return m.restore(state)
+}
+
+// Run checks whether to restore every Interval until ctx is cancelled. Errors are logged rather
+// than returned.
+func (m *AwayMode) Run(ctx context.Context) error {
+	interval := m.Interval
+	if interval == 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := m.Tick()
+		if err != nil {
+			m.AirTouch.logger().Warn("away mode failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick refreshes the state. While away it restores the configuration once the return is within
+// the time the groups need to reach their setpoints, otherwise it learns the ramp rates.
+func (m *AwayMode) Tick() error {
+	a := m.AirTouch
+
+	err := a.GetGroupData()
+	if err != nil {
+		return err
+	}
+
+	err = a.GetACData()
+	if err != nil {
+		return err
+	}
+
+	snapshot := a.Snapshot()
+	snapshot.Timestamp = m.clock()
+
+	state, away := m.State()
+	if !away {
+		m.learn(snapshot)
+		return nil
+	}
+
+	lead := m.Preconditioning(state)
+	if m.clock().Before(state.Return.Add(-lead)) {
+		return nil
+	}
+
+	a.logger().Info("pre-conditioning for return", "return", state.Return, "lead", lead)
+
+	return m.restore(state)
+}
+
+// Preconditioning returns how long before the return the stored configuration needs to be
+// restored for the groups that were on to reach their setpoints from their current
+// temperatures.
+func (m *AwayMode) Preconditioning(state AwayState) time.Duration {
+	a := m.AirTouch
+
+	if len(state.Snapshot.ACs) == 0 || !compressorRunning(state.Snapshot.ACs[0].Power, state.Snapshot.ACs[0].Mode) {
+		return 0
+	}
+
+	mode := state.Snapshot.ACs[0].Mode
+	rates := m.RampRates()
+
+	defaultRate := m.DefaultRampRate
+	if defaultRate == 0 {
+		defaultRate = 2
+	}
+
+	maximum := m.MaxPreconditioning
+	if maximum == 0 {
+		maximum = 3 * time.Hour
+	}
+
+	var lead time.Duration
+
+	for _, stored := range state.Snapshot.Groups {
+		if stored.Power == "Off" || stored.ControlMethod != "TemperatureControl" {
+			continue
+		}
+
+		g := a.groupByNumber(stored.Number)
+		if g == nil || !g.Sensor {
+			continue
+		}
+
+		distance := g.Temperature - float64(stored.TargetSetpoint)
+		learned := rates.Cool
+
+		if heating(mode, distance) {
+			distance = -distance
+			learned = rates.Heat
+		}
+
+		if distance <= 0 {
+			continue
+		}
+
+		rate, ok := learned[stored.Number]
+		if !ok {
+			rate = defaultRate
+		}
+
+		needed := maximum
+		if rate > 0 {
+			needed = time.Duration(distance / rate * float64(time.Hour))
+		}
+
+		if needed > lead {
+			lead = needed
+		}
+	}
+
+	if lead > maximum {
+		lead = maximum
+	}
+
+	return lead.Round(time.Minute)
+}
+
+// RampRates returns the learned ramp rates.
+func (m *AwayMode) RampRates() RampRates {
+	rates := RampRates{Cool: make(map[int]float64), Heat: make(map[int]float64)}
+
+	value, err := m.AirTouch.ReadStringFromFile(rampRatesFile)
+	if err != nil {
+		return rates
+	}
+
+	err = json.Unmarshal([]byte(value), &rates)
+	if err != nil {
+		m.AirTouch.logger().Warn("ignoring unreadable ramp rates", "error", err)
+		return RampRates{Cool: make(map[int]float64), Heat: make(map[int]float64)}
+	}
+
+	if rates.Cool == nil {
+		rates.Cool = make(map[int]float64)
+	}
+
+	if rates.Heat == nil {
+		rates.Heat = make(map[int]float64)
+	}
+
+	return rates
+}
+
+// learn updates the ramp rates of the groups that were being heated or cooled towards their
+// setpoint since the last sample.
+func (m *AwayMode) learn(snapshot Snapshot) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	last := m.sample
+	if last == nil || snapshot.Timestamp.Sub(last.Timestamp) > 3*rampSamplePeriod {
+		m.sample = &snapshot
+		return
+	}
+
+	elapsed := snapshot.Timestamp.Sub(last.Timestamp)
+	if elapsed < rampSamplePeriod {
+		return
+	}
+
+	m.sample = &snapshot
+
+	if len(last.ACs) == 0 || len(snapshot.ACs) == 0 {
+		return
+	}
+
+	mode := last.ACs[0].Mode
+	if !compressorRunning(last.ACs[0].Power, mode) || snapshot.ACs[0].Mode != mode || snapshot.ACs[0].Power != last.ACs[0].Power {
+		return
+	}
+
+	rates := m.RampRates()
+	learned := false
+
+	for _, before := range last.Groups {
+		for _, after := range snapshot.Groups {
+			if after.Number != before.Number || !ramping(before, after) {
+				continue
+			}
+
+			distance := *before.Temperature - float64(before.TargetSetpoint)
+			change := *before.Temperature - *after.Temperature
+			target := rates.Cool
+
+			if heating(mode, distance) {
+				distance = -distance
+				change = -change
+				target = rates.Heat
+			}
+
+			// Groups already close to their setpoint are only holding it.
+			if distance < 0.5 {
+				continue
+			}
+
+			rate := math.Max(change, 0) / elapsed.Hours()
+			if previous, ok := target[before.Number]; ok {
+				rate = previous + rampSmoothing*(rate-previous)
+			}
+
+			target[before.Number] = rate
+			learned = true
+		}
+	}
+
+	if !learned {
+		return
+	}
+
+	data, err := json.Marshal(rates)
+	if err == nil {
+		err = m.AirTouch.WriteValueToFile(rampRatesFile, string(data))
+	}
+
+	if err != nil {
+		m.AirTouch.logger().Warn("unable to save ramp rates", "error", err)
+	}
+}
+
+// ramping returns true if a group stayed on under temperature control at the same setpoint with
+// a sensor between two samples.
+func ramping(before SnapshotGroup, after SnapshotGroup) bool {
+	return before.Power == "On" && after.Power == "On" &&
+		before.ControlMethod == "TemperatureControl" && after.ControlMethod == "TemperatureControl" &&
+		before.TargetSetpoint == after.TargetSetpoint &&
+		before.Temperature != nil && after.Temperature != nil
+}
+
+// heating returns true if the AC works to raise the temperature in mode. Auto heats groups below
+// their setpoint.
+func heating(mode string, distance float64) bool {
+	switch mode {
+	case "Heat", "AutoHeat":
+		return true
+	case "Auto":
+		return distance < 0
+	}
+
+	return false
+}
+
+// restore sends the stored configuration and ends away mode once it has been applied.
+func (m *AwayMode) restore(state AwayState) error {
+	a := m.AirTouch
+
+	r := Reconciler{AirTouch: a}
+	r.SetDesired(state.Snapshot.DesiredState())
+
+	_, err := r.Reconcile()
+	if err != nil {
+		return err
+	}
+
+	a.logger().Info("restored configuration from before away", "started", state.Started)
+
+	err = os.Remove(filepath.Join(a.RootTempDir, awayFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// save persists the away state.
+func (m *AwayMode) save(state *AwayState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return m.AirTouch.WriteValueToFile(awayFile, string(data))
+}
+
+// clock returns the current time.
+func (m *AwayMode) clock() time.Time {
+	if m.now != nil {
+		return m.now()
+	}
+
+	return time.Now()
+}
@@ -0,0 +1,136 @@
+package airtouch
+
+import (
+	"testing"
+	"time"
+)
+
+// acStatusOffReply is an AC status reply for an AC that is off, in Cool mode at 22 degrees.
+var acStatusOffReply = replyFrame(ACStatusType, []byte{0x00, 0x42, 0x16, 0x00, 0x5b, 0x60, 0x00, 0x00})
+
+func TestAwayMode(t *testing.T) {
+	controls := 0
+	acReply := acStatusReply
+	a := fakeConsole(t, func(request []byte) []byte {
+		switch request[5] {
+		case 0x1f:
+			return replyFrame(0x1f, groupNameSeed)
+		case 0x2c:
+			controls++
+			if controls == 1 {
+				acReply = acStatusOffReply
+			} else {
+				acReply = acStatusReply
+			}
+			return acReply
+		case 0x2a, 0x2b:
+			return groupStatusReply
+		}
+		return acReply
+	})
+	a.Confirmation = ConfirmNone
+	a.RootTempDir = t.TempDir()
+
+	start := time.Date(2024, 7, 1, 8, 0, 0, 0, time.UTC)
+	now := start
+	m := AwayMode{AirTouch: a, now: func() time.Time { return now }}
+
+	returnAt := start.Add(10 * time.Hour)
+	if err := m.Start(returnAt, DesiredState{ACPower: "Off"}); err != nil {
+		t.Fatal(err)
+	}
+
+	state, away := m.State()
+	if !away || state.Snapshot.ACs[0].Power != "On" || !state.Return.Equal(returnAt) {
+		t.Fatalf("expected the AC to be stored as on, got %+v", state)
+	}
+
+	if controls != 1 || a.AC.PowerState != "Off" {
+		t.Fatalf("expected the AC to be set back to off, got %d control messages and %s", controls, a.AC.PowerState)
+	}
+
+	if err := m.Start(returnAt, DesiredState{}); err == nil {
+		t.Error("expected starting twice to fail")
+	}
+
+	// Group 0 is above its setpoint, so it needs a while at the default ramp rate.
+	lead := m.Preconditioning(state)
+	if lead <= 0 || lead > time.Hour {
+		t.Fatalf("expected less than an hour of pre-conditioning, got %v", lead)
+	}
+
+	now = returnAt.Add(-lead - time.Minute)
+	if err := m.Tick(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, away := m.State(); !away || controls != 1 {
+		t.Errorf("expected to still be away, got %d control messages", controls)
+	}
+
+	now = returnAt.Add(-lead)
+	if err := m.Tick(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, away := m.State(); away || controls != 2 || a.AC.PowerState != "On" {
+		t.Errorf("expected the AC to be restored, got %d control messages and %s", controls, a.AC.PowerState)
+	}
+
+	// Returning when not away does nothing.
+	if err := m.Return(); err != nil || controls != 2 {
+		t.Errorf("expected nothing to be sent, got %d control messages and %v", controls, err)
+	}
+}
+
+func TestAwayRampRates(t *testing.T) {
+	a := &AirTouch{RootTempDir: t.TempDir()}
+	m := AwayMode{AirTouch: a}
+
+	sample := func(minutes int, mode string, temperature float64, setpoint int) Snapshot {
+		return Snapshot{
+			Timestamp: time.Date(2024, 7, 1, 8, minutes, 0, 0, time.UTC),
+			ACs:       []SnapshotAC{{Power: "On", Mode: mode}},
+			Groups: []SnapshotGroup{
+				{Number: 0, Power: "On", ControlMethod: "TemperatureControl", TargetSetpoint: setpoint, Temperature: &temperature},
+			},
+		}
+	}
+
+	m.learn(sample(0, "Cool", 26, 22))
+	m.learn(sample(5, "Cool", 25.9, 22)) // Too soon after the last sample.
+	m.learn(sample(10, "Cool", 25.5, 22))
+
+	if rate := m.RampRates().Cool[0]; rate < 2.99 || rate > 3.01 {
+		t.Errorf("expected to cool at 3 degrees an hour, got %v", rate)
+	}
+
+	m.learn(sample(20, "Cool", 24.5, 22))
+
+	if rate := m.RampRates().Cool[0]; rate < 3.59 || rate > 3.61 {
+		t.Errorf("expected the rate to move towards 6 degrees an hour, got %v", rate)
+	}
+
+	// A mode change starts again, and groups holding their setpoint don't count.
+	m.learn(sample(30, "Heat", 18, 22))
+	m.learn(sample(40, "Heat", 18.5, 22))
+	m.learn(sample(90, "Heat", 21.8, 22))
+	m.learn(sample(100, "Heat", 21.9, 22))
+
+	if rate := m.RampRates().Heat[0]; rate < 2.99 || rate > 3.01 {
+		t.Errorf("expected to heat at 3 degrees an hour, got %v", rate)
+	}
+
+	// The groups need 6 degrees at 3.6 degrees an hour.
+	a.Groups = []Group{{Number: 0, Sensor: true, Temperature: 28}}
+	state := sample(0, "Cool", 26, 22)
+
+	if lead := m.Preconditioning(AwayState{Snapshot: state}); lead != 100*time.Minute {
+		t.Errorf("expected 100 minutes of pre-conditioning, got %v", lead)
+	}
+
+	m.MaxPreconditioning = time.Hour
+	if lead := m.Preconditioning(AwayState{Snapshot: state}); lead != time.Hour {
+		t.Errorf("expected pre-conditioning to be capped at an hour, got %v", lead)
+	}
+}
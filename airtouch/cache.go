@@ -0,0 +1,103 @@
+package airtouch
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	cacheGroups = "groups"
+	cacheAC     = "ac"
+)
+
+// errRefreshFailed is returned to callers waiting on a refresh that panicked.
+var errRefreshFailed = errors.New("airtouch: refresh did not complete")
+
+// cacheEntry is the state a cached fetch decoded. An AC fetch only fills ac and a group fetch only
+// fills groups.
+type cacheEntry struct {
+	fetched time.Time
+	ac      AC
+	groups  []Group
+}
+
+// copy returns the entry with its own copy of the groups.
+func (e cacheEntry) copy() cacheEntry {
+	e.groups = append([]Group(nil), e.groups...)
+	return e
+}
+
+// refresh is a console request that concurrent callers wait on rather than repeating.
+type refresh struct {
+	done  chan struct{}
+	err   error
+	entry cacheEntry
+}
+
+// cached runs fetch unless the last successful fetch for key is younger than CacheMaxAge.
+// Concurrent callers for the same key share a single fetch and its error, and get copies of the
+// state it returned. Fetches run one at a time under stateMu, as they write AC and Groups.
+func (a *AirTouch) cached(key string, fetch func() (cacheEntry, error)) (cacheEntry, error) {
+	a.cacheMu.Lock()
+
+	if a.CacheMaxAge > 0 {
+		if entry, ok := a.cacheEntries[key]; ok && time.Since(entry.fetched) < a.CacheMaxAge {
+			entry = entry.copy()
+			a.cacheMu.Unlock()
+			a.logger().Debug("serving cached snapshot", "snapshot", key, "age", time.Since(entry.fetched))
+			return entry, nil
+		}
+	}
+
+	if inFlight, ok := a.cacheInFlight[key]; ok {
+		a.cacheMu.Unlock()
+		<-inFlight.done
+		return inFlight.entry.copy(), inFlight.err
+	}
+
+	inFlight := &refresh{done: make(chan struct{}), err: errRefreshFailed}
+	if a.cacheInFlight == nil {
+		a.cacheInFlight = make(map[string]*refresh)
+	}
+	a.cacheInFlight[key] = inFlight
+	generation := a.cacheGeneration
+	a.cacheMu.Unlock()
+
+	func() {
+		// Waiters are released even if fetch panics.
+		defer func() {
+			a.cacheMu.Lock()
+			delete(a.cacheInFlight, key)
+
+			// A control message sent during the fetch may not be reflected in it, so don't cache it.
+			if inFlight.err == nil && generation == a.cacheGeneration {
+				if a.cacheEntries == nil {
+					a.cacheEntries = make(map[string]cacheEntry)
+				}
+				inFlight.entry.fetched = time.Now()
+				a.cacheEntries[key] = inFlight.entry
+			}
+			a.cacheMu.Unlock()
+
+			close(inFlight.done)
+		}()
+
+		a.stateMu.Lock()
+		defer a.stateMu.Unlock()
+
+		entry, err := fetch()
+		inFlight.entry, inFlight.err = entry, err
+	}()
+
+	return inFlight.entry.copy(), inFlight.err
+}
+
+// InvalidateCache forces the next GetGroupData and GetACData calls to query the console. It is
+// called after every control message.
+func (a *AirTouch) InvalidateCache() {
+	a.cacheMu.Lock()
+	defer a.cacheMu.Unlock()
+
+	a.cacheEntries = nil
+	a.cacheGeneration++
+}
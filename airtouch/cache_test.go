@@ -0,0 +1,157 @@
+package airtouch
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheServesRecentSnapshots(t *testing.T) {
+	var requests atomic.Int32
+	a := fakeConsole(t, func(request []byte) []byte {
+		requests.Add(1)
+		return acStatusReply
+	})
+	a.CacheMaxAge = time.Minute
+
+	for i := 0; i < 3; i++ {
+		if err := a.GetACData(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if requests.Load() != 1 {
+		t.Errorf("expected 1 request, got %d", requests.Load())
+	}
+
+	// Control messages invalidate the cache.
+	if err := a.SetACState("On", "Cool"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.GetACData(); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests.Load() != 3 {
+		t.Errorf("expected 3 requests, got %d", requests.Load())
+	}
+}
+
+func TestCacheExpires(t *testing.T) {
+	var requests atomic.Int32
+	a := fakeConsole(t, func(request []byte) []byte {
+		requests.Add(1)
+		return acStatusReply
+	})
+	a.CacheMaxAge = time.Millisecond
+
+	for i := 0; i < 2; i++ {
+		if err := a.GetACData(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	if requests.Load() != 2 {
+		t.Errorf("expected 2 requests, got %d", requests.Load())
+	}
+}
+
+func TestCacheCoalescesConcurrentRefreshes(t *testing.T) {
+	var requests atomic.Int32
+	a := fakeConsole(t, func(request []byte) []byte {
+		requests.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return acStatusReply
+	})
+	a.CacheMaxAge = time.Minute
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ac, err := a.ACData()
+			if err != nil {
+				t.Error(err)
+			}
+			if ac.AcMode != "Cool" {
+				t.Errorf("expected a copy of the decoded AC, got %+v", ac)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if requests.Load() != 1 {
+		t.Errorf("expected 1 request, got %d", requests.Load())
+	}
+}
+
+func TestCacheReleasesWaitersOnPanic(t *testing.T) {
+	a := &AirTouch{}
+	started := make(chan struct{})
+
+	go func() {
+		defer func() { recover() }()
+		a.cached(cacheAC, func() (cacheEntry, error) {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+			panic("decode")
+		})
+	}()
+
+	<-started
+
+	_, err := a.cached(cacheAC, func() (cacheEntry, error) {
+		t.Error("expected to wait on the refresh in flight")
+		return cacheEntry{}, nil
+	})
+	if err != errRefreshFailed {
+		t.Errorf("expected errRefreshFailed, got %v", err)
+	}
+}
+
+func TestCacheKeepsACAndGroupsApart(t *testing.T) {
+	a := fakeConsole(t, func(request []byte) []byte {
+		switch request[5] {
+		case 0x1f:
+			return replyFrame(0x1f, groupNameSeed)
+		case 0x2b:
+			return groupStatusReply
+		default:
+			return acStatusReply
+		}
+	})
+	a.CacheMaxAge = time.Minute
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := a.ACData(); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := a.GroupData(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// A cache hit for one key never returns the state the other key's fetch left behind.
+	groups, err := a.GroupData()
+	if err != nil || len(groups) != 2 || groups[0].Name != "Living" {
+		t.Errorf("expected the cached groups, got %+v, %v", groups, err)
+	}
+
+	ac, err := a.ACData()
+	if err != nil || ac.AcMode != "Cool" {
+		t.Errorf("expected the cached AC, got %+v, %v", ac, err)
+	}
+}
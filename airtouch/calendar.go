@@ -0,0 +1,253 @@
+package airtouch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apognu/gocal"
+)
+
+// Preset is the changes applied while a matching calendar event is on.
+type Preset struct {
+	// Event is an event title or category, compared ignoring case.
+	Event string
+	// Targets maps ScheduleTargetAC or a group number, name or alias to its change. The entries'
+	// times and Days are ignored.
+	Targets map[string]ScheduleEntry
+}
+
+// calendarEvent is an instance of a calendar event that is on now.
+type calendarEvent struct {
+	// Instance identifies this occurrence of the event.
+	Instance string
+	Summary  string
+	Start    time.Time
+	End      time.Time
+	Event    gocal.Event
+}
+
+// calendarChange is the change an active event makes to a target.
+type calendarChange struct {
+	Target   string
+	Entry    ScheduleEntry
+	Event    string
+	Instance string
+}
+
+// SetPresets validates and replaces the presets applied by calendar events.
+func (s *Scheduler) SetPresets(presets []Preset) error {
+	for _, preset := range presets {
+		if strings.TrimSpace(preset.Event) == "" {
+			return &ValidationError{Field: "Event", Value: preset.Event, Reason: "presets must name an event title or category"}
+		}
+
+		for target, entry := range preset.Targets {
+			check := entry
+			check.At = "00:00"
+			check.Solar = ""
+			check.Offset = 0
+
+			err := s.AirTouch.validateScheduleEntry(target, check)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.presets = presets
+
+	return nil
+}
+
+// calendarChanges returns the changes of the calendar events that are on now, by lower case
+// target. Where events overlap, the one that started last wins.
+func (s *Scheduler) calendarChanges(now time.Time, loc *time.Location) (map[string]calendarChange, error) {
+	s.mu.Lock()
+	presets := append([]Preset(nil), s.presets...)
+	s.mu.Unlock()
+
+	changes := make(map[string]calendarChange)
+	if len(s.Calendars) == 0 || len(presets) == 0 {
+		return changes, nil
+	}
+
+	var events []calendarEvent
+	var errs []error
+
+	for _, path := range s.Calendars {
+		found, err := readCalendar(path, now, loc)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		events = append(events, found...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+
+	for _, event := range events {
+		for _, preset := range presets {
+			if !presetMatches(preset, event.Event) {
+				continue
+			}
+
+			for target, entry := range preset.Targets {
+				changes[strings.ToLower(target)] = calendarChange{
+					Target:   target,
+					Entry:    entry,
+					Event:    event.Summary,
+					Instance: event.Instance,
+				}
+			}
+		}
+	}
+
+	return changes, errors.Join(errs...)
+}
+
+// calendarBoundary returns when the next event that changes target starts or ends, within a
+// week. Calendars that can't be read are left out; Tick reports them.
+func (s *Scheduler) calendarBoundary(target string, now time.Time, loc *time.Location) (time.Time, bool) {
+	s.mu.Lock()
+	presets := append([]Preset(nil), s.presets...)
+	s.mu.Unlock()
+
+	var boundary time.Time
+
+	for _, path := range s.Calendars {
+		events, err := readCalendarEvents(path, now.Add(-48*time.Hour), now.Add(8*24*time.Hour), loc)
+		if err != nil {
+			continue
+		}
+
+		for _, event := range events {
+			if !presetsChange(presets, event.Event, target) {
+				continue
+			}
+
+			for _, t := range []time.Time{event.Start, event.End} {
+				if t.After(now) && (boundary.IsZero() || t.Before(boundary)) {
+					boundary = t
+				}
+			}
+		}
+	}
+
+	return boundary, !boundary.IsZero()
+}
+
+// presetsChange returns true if a preset matching event changes target.
+func presetsChange(presets []Preset, event gocal.Event, target string) bool {
+	for _, preset := range presets {
+		if !presetMatches(preset, event) {
+			continue
+		}
+
+		for t := range preset.Targets {
+			if strings.EqualFold(t, target) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// readCalendar returns the events of an ICS file that are on now, with recurring events expanded
+// and their exceptions applied. Times without a timezone are read in loc.
+func readCalendar(path string, now time.Time, loc *time.Location) ([]calendarEvent, error) {
+	// The window is wide enough to still hold the event after floating times are moved from the
+	// local timezone to loc.
+	events, err := readCalendarEvents(path, now.Add(-48*time.Hour), now.Add(48*time.Hour), loc)
+	if err != nil {
+		return nil, err
+	}
+
+	var on []calendarEvent
+	for _, event := range events {
+		if !now.Before(event.Start) && now.Before(event.End) {
+			on = append(on, event)
+		}
+	}
+
+	return on, nil
+}
+
+// readCalendarEvents returns the events of an ICS file between start and end.
+func readCalendarEvents(path string, start time.Time, end time.Time, loc *time.Location) ([]calendarEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("calendar %s: %w", path, err)
+	}
+	defer f.Close()
+
+	parser := gocal.NewParser(f)
+	parser.Start = &start
+	parser.End = &end
+	parser.AllDayEventsTZ = loc
+	// Hand written calendars often leave out attributes like DTSTAMP, so only the attributes that
+	// can't be read are skipped.
+	parser.Strict.Mode = gocal.StrictModeFailAttribute
+
+	err = parser.Parse()
+	if err != nil {
+		return nil, fmt.Errorf("calendar %s: %w", path, err)
+	}
+
+	var events []calendarEvent
+
+	for _, event := range parser.Events {
+		if event.Start == nil || event.End == nil {
+			continue
+		}
+
+		eventStart := floating(*event.Start, event.RawStart, loc)
+		eventEnd := floating(*event.End, event.RawEnd, loc)
+
+		events = append(events, calendarEvent{
+			Instance: path + "/" + event.Uid + "/" + eventStart.Format(time.RFC3339),
+			Summary:  strings.TrimSpace(event.Summary),
+			Start:    eventStart,
+			End:      eventEnd,
+			Event:    event,
+		})
+	}
+
+	return events, nil
+}
+
+// floating moves a time without a timezone or UTC marker from the local timezone, where the
+// parser reads it, to loc.
+func floating(t time.Time, raw gocal.RawDate, loc *time.Location) time.Time {
+	if raw.Params["TZID"] != "" || strings.HasSuffix(raw.Value, "Z") || len(raw.Value) == 8 || raw.Params["VALUE"] == "DATE" {
+		return t
+	}
+
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// presetMatches returns true if an event's title or one of its categories is the preset's event.
+func presetMatches(preset Preset, event gocal.Event) bool {
+	name := strings.TrimSpace(preset.Event)
+
+	if strings.EqualFold(strings.TrimSpace(event.Summary), name) {
+		return true
+	}
+
+	for _, category := range event.Categories {
+		if strings.EqualFold(strings.TrimSpace(category), name) {
+			return true
+		}
+	}
+
+	return false
+}
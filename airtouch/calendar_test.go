@@ -0,0 +1,226 @@
+package airtouch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// calendarSeed has a weekly office day with one day cancelled and one moved, a floating travel
+// event without a DTSTAMP and an all-day school holiday.
+var calendarSeed = strings.Join([]string{
+	"BEGIN:VCALENDAR",
+	"VERSION:2.0",
+	"BEGIN:VEVENT",
+	"UID:office",
+	"DTSTAMP:20240601T000000Z",
+	"SUMMARY:Work",
+	"CATEGORIES:Office",
+	"DTSTART;TZID=Australia/Sydney:20240701T090000",
+	"DTEND;TZID=Australia/Sydney:20240701T170000",
+	"RRULE:FREQ=WEEKLY;BYDAY=MO,WE",
+	"EXDATE;TZID=Australia/Sydney:20240703T090000",
+	"END:VEVENT",
+	"BEGIN:VEVENT",
+	"UID:office",
+	"DTSTAMP:20240601T000000Z",
+	"SUMMARY:Work",
+	"CATEGORIES:Office",
+	"RECURRENCE-ID;TZID=Australia/Sydney:20240708T090000",
+	"DTSTART;TZID=Australia/Sydney:20240708T120000",
+	"DTEND;TZID=Australia/Sydney:20240708T170000",
+	"END:VEVENT",
+	"BEGIN:VEVENT",
+	"UID:travel",
+	"SUMMARY:Travel",
+	"DTSTART:20240702T100000",
+	"DTEND:20240702T120000",
+	"END:VEVENT",
+	"BEGIN:VEVENT",
+	"UID:holidays",
+	"DTSTAMP:20240601T000000Z",
+	"SUMMARY:School holidays",
+	"DTSTART;VALUE=DATE:20240706",
+	"DTEND;VALUE=DATE:20240708",
+	"END:VEVENT",
+	"END:VCALENDAR",
+}, "\r\n")
+
+// writeCalendar writes calendarSeed to a temporary file.
+func writeCalendar(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "family.ics")
+	if err := os.WriteFile(path, []byte(calendarSeed), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestReadCalendar(t *testing.T) {
+	path := writeCalendar(t)
+	loc, _ := time.LoadLocation("Australia/Sydney")
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		expected []string
+	}{
+		{"before work", time.Date(2024, 7, 1, 8, 59, 0, 0, loc), nil},
+		{"at work", time.Date(2024, 7, 1, 9, 0, 0, 0, loc), []string{"Work"}},
+		{"end of work", time.Date(2024, 7, 1, 17, 0, 0, 0, loc), nil},
+		{"cancelled", time.Date(2024, 7, 3, 10, 0, 0, 0, loc), nil},
+		{"moved from", time.Date(2024, 7, 8, 10, 0, 0, 0, loc), nil},
+		{"moved to", time.Date(2024, 7, 8, 13, 0, 0, 0, loc), []string{"Work"}},
+		{"next week", time.Date(2024, 7, 10, 10, 0, 0, 0, loc), []string{"Work"}},
+		{"floating", time.Date(2024, 7, 2, 10, 30, 0, 0, loc), []string{"Travel"}},
+		{"all day", time.Date(2024, 7, 7, 23, 30, 0, 0, loc), []string{"School holidays"}},
+		{"after all day", time.Date(2024, 7, 8, 0, 30, 0, 0, loc), nil},
+	}
+
+	// Floating times follow the timezone they are read in.
+	events, err := readCalendar(path, time.Date(2024, 7, 2, 10, 30, 0, 0, time.UTC), time.UTC)
+	if err != nil || len(events) != 1 || events[0].Summary != "Travel" {
+		t.Errorf("expected travel in UTC, got %+v, %v", events, err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events, err := readCalendar(path, test.now, loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var summaries []string
+			for _, event := range events {
+				summaries = append(summaries, event.Summary)
+			}
+
+			if !reflect.DeepEqual(summaries, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, summaries)
+			}
+		})
+	}
+}
+
+func TestSchedulerCalendar(t *testing.T) {
+	var controls [][]byte
+	a := fakeConsole(t, func(request []byte) []byte {
+		switch request[5] {
+		case 0x2a:
+			controls = append(controls, request)
+			return groupStatusReply
+		case 0x2b:
+			return groupStatusReply
+		}
+		return acStatusReply
+	})
+	a.Confirmation = ConfirmNone
+	a.Timezone = "Australia/Sydney"
+
+	loc, _ := time.LoadLocation(a.Timezone)
+	var now time.Time
+	s := Scheduler{AirTouch: a, Calendars: []string{writeCalendar(t)}, now: func() time.Time { return now }}
+
+	err := s.SetPrograms([]Program{{Target: "0", Entries: []ScheduleEntry{{At: "07:00", Power: "On", TargetSetpoint: "22"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.SetPresets([]Preset{{Event: "office", Targets: map[string]ScheduleEntry{"0": {Power: "Off"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		at       time.Time
+		controls int
+	}{
+		{time.Date(2024, 7, 1, 8, 0, 0, 0, loc), 1},  // The program's 07:00 entry.
+		{time.Date(2024, 7, 1, 9, 5, 0, 0, loc), 2},  // The office day starts.
+		{time.Date(2024, 7, 1, 12, 0, 0, 0, loc), 2}, // Applied once per event.
+		{time.Date(2024, 7, 1, 17, 5, 0, 0, loc), 3}, // The program takes over again.
+		{time.Date(2024, 7, 1, 18, 0, 0, 0, loc), 3},
+		{time.Date(2024, 7, 3, 10, 0, 0, 0, loc), 4}, // Cancelled, so only Wednesday's 07:00 entry.
+	}
+
+	for _, step := range steps {
+		now = step.at
+		if err := s.Tick(); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(controls) != step.controls {
+			t.Errorf("%v: expected %d control messages, got %d", step.at, step.controls, len(controls))
+		}
+	}
+
+	// A missing calendar is reported but the programs still run.
+	s.Calendars = append(s.Calendars, filepath.Join(t.TempDir(), "missing.ics"))
+	now = time.Date(2024, 7, 4, 8, 0, 0, 0, loc)
+
+	if err := s.Tick(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing calendar error, got %v", err)
+	}
+
+	if len(controls) != 5 {
+		t.Errorf("expected Thursday's entry to be applied, got %d control messages", len(controls))
+	}
+}
+
+func TestPresetValidation(t *testing.T) {
+	s := Scheduler{AirTouch: &AirTouch{}}
+
+	tests := []Preset{
+		{Targets: map[string]ScheduleEntry{"0": {Power: "Off"}}},
+		{Event: "Office", Targets: map[string]ScheduleEntry{"0": {Mode: "Cool"}}},
+		{Event: "Office", Targets: map[string]ScheduleEntry{ScheduleTargetAC: {Mode: "Freeze"}}},
+	}
+
+	for _, preset := range tests {
+		if err := s.SetPresets([]Preset{preset}); !errors.Is(err, ErrValidation) {
+			t.Errorf("expected a validation error for %+v, got %v", preset, err)
+		}
+	}
+}
+
+func TestSchedulerHoldCalendar(t *testing.T) {
+	a := fakeConsole(t, func(request []byte) []byte {
+		if request[5] == 0x2a || request[5] == 0x2b {
+			return groupStatusReply
+		}
+		return acStatusReply
+	})
+	a.Confirmation = ConfirmNone
+	a.Timezone = "Australia/Sydney"
+
+	loc, _ := time.LoadLocation(a.Timezone)
+	now := time.Date(2024, 7, 1, 10, 0, 0, 0, loc)
+	s := Scheduler{AirTouch: a, Calendars: []string{writeCalendar(t)}, now: func() time.Time { return now }}
+
+	err := s.SetPresets([]Preset{{Event: "office", Targets: map[string]ScheduleEntry{"1": {Power: "Off"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Group 1 only follows the calendar, so the hold ends with the office day.
+	if err := s.Hold("1", ScheduleEntry{Power: "On"}); err != nil {
+		t.Fatal(err)
+	}
+
+	holds := s.Holds()
+	if len(holds) != 1 || !holds[0].Until.Equal(time.Date(2024, 7, 1, 17, 0, 0, 0, loc)) {
+		t.Errorf("expected the hold to end at 17:00, got %+v", holds)
+	}
+
+	// Nothing would ever end a hold on group 0.
+	if err := s.Hold("0", ScheduleEntry{Power: "On"}); !errors.Is(err, ErrValidation) {
+		t.Errorf("expected a hold without an end to be rejected, got %v", err)
+	}
+}
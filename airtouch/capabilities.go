@@ -0,0 +1,148 @@
+package airtouch
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Capabilities limits the control messages that are sent to the console.
+type Capabilities struct {
+	MinCoolSetpoint int
+	MaxCoolSetpoint int
+	MinHeatSetpoint int
+	MaxHeatSetpoint int
+	// StartGroup and GroupCount are the range of group numbers served by the AC. A GroupCount of
+	// zero checks group numbers against the groups seen in the last status or name reply.
+	StartGroup int
+	GroupCount int
+	// Modes are the ACModeMap modes the AC supports.
+	Modes []string
+}
+
+// DefaultCapabilities are used until GetACAbility is called or Capabilities is set. The setpoint
+// range is the range of the AirTouch 4 console.
+func (a *AirTouch) DefaultCapabilities() Capabilities {
+	capabilities := Capabilities{
+		MinCoolSetpoint: 16,
+		MaxCoolSetpoint: 30,
+		MinHeatSetpoint: 16,
+		MaxHeatSetpoint: 30,
+	}
+
+	for mode := range a.ACModeMap() {
+		capabilities.Modes = append(capabilities.Modes, mode)
+	}
+
+	return capabilities
+}
+
+// GetACAbility sends and decodes the ACAbility reply into Capabilities.
+func (a *AirTouch) GetACAbility() error {
+	messageIn := MessageInput{
+		Message: ACAbility,
+	}
+
+	messageOut, err := a.CommunicateMessage(&messageIn)
+	if err != nil {
+		return err
+	}
+
+	return a.DecodeACAbilityMessage(*messageOut)
+}
+
+// capabilities returns the configured or decoded capabilities, falling back to the defaults.
+func (a *AirTouch) capabilities() Capabilities {
+	if a.Capabilities != nil {
+		return *a.Capabilities
+	}
+
+	return a.DefaultCapabilities()
+}
+
+// setpointRange returns the setpoints allowed in the current AC mode. Modes that are neither
+// heating nor cooling allow either range.
+func (c Capabilities) setpointRange(mode string) (int, int) {
+	switch mode {
+	case "Heat", "AutoHeat":
+		return c.MinHeatSetpoint, c.MaxHeatSetpoint
+	case "Cool", "AutoCool":
+		return c.MinCoolSetpoint, c.MaxCoolSetpoint
+	}
+
+	return min(c.MinCoolSetpoint, c.MinHeatSetpoint), max(c.MaxCoolSetpoint, c.MaxHeatSetpoint)
+}
+
+// validateACMode checks that the AC supports a mode.
+func (a *AirTouch) validateACMode(mode string) error {
+	for _, supported := range a.capabilities().Modes {
+		if supported == mode {
+			return nil
+		}
+	}
+
+	return &ValidationError{Field: "AcMode", Value: mode, Reason: "not supported by the AC"}
+}
+
+// validateGroupChange checks a resolved group change against the capabilities before any frame is
+// built for it.
+func (a *AirTouch) validateGroupChange(number int, change GroupChange) error {
+	return a.validateGroupChangeInMode(number, change, a.AC.AcMode)
+}
+
+// validateGroupChangeInMode checks a group change against the setpoint range of an AC mode.
+func (a *AirTouch) validateGroupChangeInMode(number int, change GroupChange, mode string) error {
+	capabilities := a.capabilities()
+
+	err := a.validateGroupNumber(capabilities, number)
+	if err != nil {
+		return err
+	}
+
+	if change.TargetSetpoint != "" {
+		setpoint, err := strconv.Atoi(change.TargetSetpoint)
+		if err != nil {
+			return &ValidationError{Field: "TargetSetpoint", Value: change.TargetSetpoint, Reason: "not a number"}
+		}
+
+		minSetpoint, maxSetpoint := capabilities.setpointRange(mode)
+		if setpoint < minSetpoint || setpoint > maxSetpoint {
+			return &ValidationError{Field: "TargetSetpoint", Value: change.TargetSetpoint, Reason: fmt.Sprintf("outside %d-%d", minSetpoint, maxSetpoint)}
+		}
+	}
+
+	if change.OpenPercentage != "" {
+		percentage, err := strconv.Atoi(change.OpenPercentage)
+		if err != nil {
+			return &ValidationError{Field: "OpenPercentage", Value: change.OpenPercentage, Reason: "not a number"}
+		}
+
+		if percentage < 0 || percentage > 100 || percentage%5 != 0 {
+			return &ValidationError{Field: "OpenPercentage", Value: change.OpenPercentage, Reason: "not a 5% step between 0 and 100"}
+		}
+	}
+
+	return nil
+}
+
+// validateGroupNumber checks a group number against the AC's group range or, when that is not
+// known, the groups seen so far. Nothing is checked before any group has been seen.
+func (a *AirTouch) validateGroupNumber(capabilities Capabilities, number int) error {
+	value := strconv.Itoa(number)
+
+	if capabilities.GroupCount > 0 {
+		if number < capabilities.StartGroup || number >= capabilities.StartGroup+capabilities.GroupCount {
+			return &ValidationError{Field: "Group", Value: value, Reason: fmt.Sprintf("outside groups %d-%d", capabilities.StartGroup, capabilities.StartGroup+capabilities.GroupCount-1)}
+		}
+		return nil
+	}
+
+	if len(a.Groups) == 0 && len(a.groupNames) == 0 {
+		return nil
+	}
+
+	if _, ok := a.groupNames[number]; ok || a.groupByNumber(number) != nil {
+		return nil
+	}
+
+	return &ValidationError{Field: "Group", Value: value, Reason: fmt.Sprintf("unknown group, %d groups are known", max(len(a.Groups), len(a.groupNames)))}
+}
@@ -0,0 +1,95 @@
+package airtouch
+
+import (
+	"errors"
+	"testing"
+)
+
+var acAbilitySeed = []byte{
+	0xff, 0x11,
+	0x00, 0x18, // AC number and following length.
+	0x00, 0x02, // Start group and group count.
+	'D', 'u', 'c', 't', 'e', 'd', 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x1a,       // Cool, fan and heat.
+	0x07,       // Fan speeds.
+	0x12, 0x1e, // Cool 18-30.
+	0x10, 0x1c, // Heat 16-28.
+}
+
+func TestDecodeACAbilityMessage(t *testing.T) {
+	a := AirTouch{}
+
+	if err := a.DecodeACAbilityMessage(MessageOutput{Body: acAbilitySeed}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := a.Capabilities
+	if c.StartGroup != 0 || c.GroupCount != 2 {
+		t.Errorf("expected groups 0-1, got %d groups from %d", c.GroupCount, c.StartGroup)
+	}
+
+	if c.MinCoolSetpoint != 18 || c.MaxCoolSetpoint != 30 || c.MinHeatSetpoint != 16 || c.MaxHeatSetpoint != 28 {
+		t.Errorf("unexpected setpoint ranges %+v", c)
+	}
+
+	if len(c.Modes) != 3 || c.Modes[0] != "Cool" || c.Modes[1] != "Fan" || c.Modes[2] != "Heat" {
+		t.Errorf("expected Cool, Fan and Heat, got %v", c.Modes)
+	}
+
+	if err := a.DecodeACAbilityMessage(MessageOutput{Body: acAbilitySeed[:20]}); !errors.Is(err, ErrDecode) {
+		t.Errorf("expected ErrDecode for a short body, got %v", err)
+	}
+}
+
+func TestCapabilityValidation(t *testing.T) {
+	requests := 0
+	a := fakeConsole(t, func(request []byte) []byte {
+		requests++
+		return groupStatusReply
+	})
+
+	a.Capabilities = &Capabilities{
+		MinCoolSetpoint: 18,
+		MaxCoolSetpoint: 30,
+		MinHeatSetpoint: 16,
+		MaxHeatSetpoint: 28,
+		StartGroup:      0,
+		GroupCount:      2,
+		Modes:           []string{"Cool", "Fan", "Heat"},
+	}
+	a.AC.AcMode = "Cool"
+
+	tests := []struct {
+		change GroupChange
+		field  string
+	}{
+		{GroupChange{Group: "0", TargetSetpoint: "17"}, "TargetSetpoint"},
+		{GroupChange{Group: "0", TargetSetpoint: "31"}, "TargetSetpoint"},
+		{GroupChange{Group: "1", OpenPercentage: "52"}, "OpenPercentage"},
+		{GroupChange{Group: "1", OpenPercentage: "105"}, "OpenPercentage"},
+		{GroupChange{Group: "2", Power: "On"}, "Group"},
+	}
+
+	for _, test := range tests {
+		err := a.SetGroups([]GroupChange{test.change})
+
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) || validationErr.Field != test.field {
+			t.Errorf("%+v: expected a %s ValidationError, got %v", test.change, test.field, err)
+		}
+	}
+
+	if err := a.SetACState("On", "Dry"); !errors.Is(err, ErrValidation) {
+		t.Errorf("expected an unsupported mode to fail validation, got %v", err)
+	}
+
+	if requests != 0 {
+		t.Errorf("expected nothing to be sent, got %d requests", requests)
+	}
+
+	// The heat range applies when heating.
+	a.AC.AcMode = "Heat"
+	if err := a.validateGroupChange(0, GroupChange{TargetSetpoint: "17"}); err != nil {
+		t.Errorf("expected 17 to be allowed when heating, got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package airtouch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	compressorStartedFile = "compressor_started"
+	compressorStoppedFile = "compressor_stopped"
+	compressorRunningFile = "compressor_running"
+)
+
+// CompressorGuardError records an AC state change that would start or stop the compressor
+// sooner than CompressorMinOffTime or CompressorMinOnTime allow. It matches ErrShortCycle.
+type CompressorGuardError struct {
+	Power       string
+	Mode        string
+	NextAllowed time.Time
+}
+
+func (e *CompressorGuardError) Error() string {
+	return fmt.Sprintf("airtouch: AC %s %s would short cycle the compressor, allowed from %s", e.Power, e.Mode, e.NextAllowed.Format(time.RFC3339))
+}
+
+// Is matches ErrShortCycle.
+func (e *CompressorGuardError) Is(target error) bool {
+	return target == ErrShortCycle
+}
+
+// compressorRunning returns true if the AC runs its compressor in a power state and mode. Fan
+// only moves air.
+func compressorRunning(powerState string, mode string) bool {
+	return powerState == "On" && mode != "Fan"
+}
+
+// checkCompressorGuard returns a CompressorGuardError if changing the AC to powerState and
+// modeState would start or stop the compressor too soon after it last stopped or started.
+func (a *AirTouch) checkCompressorGuard(powerState string, modeState string) error {
+	// Without a known current state there is nothing to guard against.
+	if a.AC.PowerState == "" {
+		return nil
+	}
+
+	running := compressorRunning(a.AC.PowerState, a.AC.AcMode)
+	starting := compressorRunning(powerState, modeState)
+
+	var file string
+	var minimum time.Duration
+
+	switch {
+	case running && !starting:
+		file, minimum = compressorStartedFile, a.CompressorMinOnTime
+	case !running && starting:
+		file, minimum = compressorStoppedFile, a.CompressorMinOffTime
+	default:
+		return nil
+	}
+
+	if minimum == 0 {
+		return nil
+	}
+
+	last, ok := a.readCompressorTime(file)
+	if !ok {
+		return nil
+	}
+
+	nextAllowed := last.Add(minimum)
+	if a.clock().Before(nextAllowed) {
+		a.logger().Warn("blocked AC change to protect the compressor", "power", powerState, "mode", modeState, "next_allowed", nextAllowed)
+		return &CompressorGuardError{Power: powerState, Mode: modeState, NextAllowed: nextAllowed}
+	}
+
+	return nil
+}
+
+// recordCompressor persists the time the compressor started or stopped when the decoded AC
+// state shows it changed, including changes made from the console or app. Without a previous
+// state, such as on each run of a one-shot program, it compares with the state the last run
+// decoded.
+func (a *AirTouch) recordCompressor(old AC, new AC) {
+	if a.CompressorMinOnTime == 0 && a.CompressorMinOffTime == 0 {
+		return
+	}
+
+	running := compressorRunning(new.PowerState, new.AcMode)
+
+	wasRunning, known := compressorRunning(old.PowerState, old.AcMode), old.PowerState != ""
+	if !known {
+		wasRunning, known = a.readCompressorRunning()
+	}
+
+	err := a.WriteValueToFile(compressorRunningFile, strconv.FormatBool(running))
+	if err != nil {
+		a.logger().Warn("unable to record compressor state", "file", compressorRunningFile, "error", err)
+	}
+
+	// The first status reply ever decoded is not a change.
+	if !known || wasRunning == running {
+		return
+	}
+
+	file := compressorStoppedFile
+	if running {
+		file = compressorStartedFile
+	}
+
+	err = a.WriteValueToFile(file, a.clock().Format(time.RFC3339))
+	if err != nil {
+		a.logger().Warn("unable to record compressor change", "file", file, "error", err)
+	}
+}
+
+// readCompressorRunning reads the compressor state recordCompressor last decoded.
+func (a *AirTouch) readCompressorRunning() (bool, bool) {
+	value, err := a.ReadStringFromFile(compressorRunningFile)
+	if err != nil {
+		return false, false
+	}
+
+	running, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		a.logger().Warn("ignoring unreadable compressor state", "file", compressorRunningFile, "error", err)
+		return false, false
+	}
+
+	return running, true
+}
+
+// readCompressorTime reads a time written by recordCompressor.
+func (a *AirTouch) readCompressorTime(file string) (time.Time, bool) {
+	value, err := a.ReadStringFromFile(file)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	last, err := time.Parse(time.RFC3339, strings.TrimSpace(value))
+	if err != nil {
+		a.logger().Warn("ignoring unreadable compressor time", "file", file, "error", err)
+		return time.Time{}, false
+	}
+
+	return last, true
+}
+
+// clock returns the current time.
+func (a *AirTouch) clock() time.Time {
+	if a.now != nil {
+		return a.now()
+	}
+
+	return time.Now()
+}
@@ -0,0 +1,102 @@
+package airtouch
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCompressorGuard(t *testing.T) {
+	requests := 0
+	a := fakeConsole(t, func(request []byte) []byte {
+		requests++
+		return acStatusReply
+	})
+
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	a.RootTempDir = dir
+	a.Confirmation = ConfirmNone
+	a.CompressorMinOnTime = 10 * time.Minute
+	a.CompressorMinOffTime = 5 * time.Minute
+	a.now = func() time.Time { return now }
+
+	a.recordCompressor(AC{PowerState: "Off", AcMode: "Cool"}, AC{PowerState: "On", AcMode: "Cool"})
+	a.AC = AC{PowerState: "On", AcMode: "Cool"}
+
+	now = now.Add(5 * time.Minute)
+	err := a.SetACState("On", "Fan")
+
+	var guardErr *CompressorGuardError
+	if !errors.As(err, &guardErr) || !errors.Is(err, ErrShortCycle) {
+		t.Fatalf("expected a CompressorGuardError, got %v", err)
+	}
+
+	if !guardErr.NextAllowed.Equal(now.Add(5 * time.Minute)) {
+		t.Errorf("expected the change to be allowed at %v, got %v", now.Add(5*time.Minute), guardErr.NextAllowed)
+	}
+
+	if requests != 0 {
+		t.Errorf("expected nothing to be sent, got %d requests", requests)
+	}
+
+	// Changes that leave the compressor running are not guarded.
+	if err := a.SetACState("On", "Heat"); err != nil {
+		t.Errorf("expected a mode change to be allowed, got %v", err)
+	}
+
+	// The times survive a restart.
+	b := AirTouch{RootTempDir: dir, CompressorMinOnTime: 10 * time.Minute, AC: a.AC, now: a.now}
+	if err := b.checkCompressorGuard("Off", "Cool"); !errors.Is(err, ErrShortCycle) {
+		t.Errorf("expected the restarted guard to block, got %v", err)
+	}
+
+	now = now.Add(6 * time.Minute)
+	if err := b.checkCompressorGuard("Off", "Cool"); err != nil {
+		t.Errorf("expected the change to be allowed after the minimum on time, got %v", err)
+	}
+
+	a.recordCompressor(AC{PowerState: "On", AcMode: "Cool"}, AC{PowerState: "On", AcMode: "Fan"})
+	a.AC = AC{PowerState: "On", AcMode: "Fan"}
+
+	now = now.Add(time.Minute)
+	if err := a.checkCompressorGuard("On", "Cool"); !errors.Is(err, ErrShortCycle) {
+		t.Errorf("expected restarting the compressor to be blocked, got %v", err)
+	}
+}
+
+func TestCompressorAcrossRuns(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Each run of a one-shot program starts without a previous state.
+	run := func(ac AC) *AirTouch {
+		a := &AirTouch{RootTempDir: dir, CompressorMinOnTime: 10 * time.Minute, CompressorMinOffTime: 5 * time.Minute, now: func() time.Time { return now }}
+		a.recordCompressor(AC{}, ac)
+		a.AC = ac
+		return a
+	}
+
+	// The first run has nothing to compare with.
+	a := run(AC{PowerState: "Off", AcMode: "Cool"})
+	if a.FileExists(compressorStartedFile) || a.FileExists(compressorStoppedFile) {
+		t.Fatal("expected the first decoded state not to be recorded as a change")
+	}
+
+	now = now.Add(time.Minute)
+	a = run(AC{PowerState: "On", AcMode: "Cool"})
+
+	now = now.Add(5 * time.Minute)
+	if err := a.checkCompressorGuard("Off", "Cool"); !errors.Is(err, ErrShortCycle) {
+		t.Errorf("expected the start between runs to be recorded, got %v", err)
+	}
+
+	// A run that decodes the same state keeps the start time.
+	now = now.Add(time.Minute)
+	a = run(AC{PowerState: "On", AcMode: "Heat"})
+
+	if last, ok := a.readCompressorTime(compressorStartedFile); !ok || !last.Equal(now.Add(-6*time.Minute)) {
+		t.Errorf("expected the start time to be kept, got %v", last)
+	}
+}
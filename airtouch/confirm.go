@@ -0,0 +1,136 @@
+package airtouch
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	// ConfirmReply checks the status reply to a control message against the request. It is used
+	// when Confirmation is empty.
+	ConfirmReply = "Reply"
+	// ConfirmReplyAndPoll checks the status reply and then polls the console for a fresh status
+	// and checks that as well.
+	ConfirmReplyAndPoll = "ReplyAndPoll"
+	// ConfirmNone skips confirmation.
+	ConfirmNone = "None"
+)
+
+// MismatchError records a control message the console replied to without applying. It matches
+// ErrRejected.
+type MismatchError struct {
+	Command string
+	// Group is the number of the group that was not changed, empty for AC commands.
+	Group     string
+	Field     string
+	Requested string
+	Actual    string
+}
+
+func (e *MismatchError) Error() string {
+	if e.Group != "" {
+		return fmt.Sprintf("airtouch: %s not applied to group %s: requested %s %s, console reports %s", e.Command, e.Group, e.Field, e.Requested, e.Actual)
+	}
+
+	return fmt.Sprintf("airtouch: %s not applied: requested %s %s, console reports %s", e.Command, e.Field, e.Requested, e.Actual)
+}
+
+// Is matches ErrRejected.
+func (e *MismatchError) Is(target error) bool {
+	return target == ErrRejected
+}
+
+// validateConfirmation checks the confirmation strategy before any control message is sent.
+func (a *AirTouch) validateConfirmation() error {
+	switch a.Confirmation {
+	case "", ConfirmReply, ConfirmReplyAndPoll, ConfirmNone:
+		return nil
+	}
+
+	return &ValidationError{Field: "Confirmation", Value: a.Confirmation, Reason: "unknown confirmation strategy"}
+}
+
+// confirm runs check against the decoded control reply and, depending on the confirmation
+// strategy, polls and runs check again.
+func (a *AirTouch) confirm(check func() error, poll func() error) error {
+	if a.Confirmation == ConfirmNone {
+		return nil
+	}
+
+	err := check()
+	if err != nil {
+		return err
+	}
+
+	if a.Confirmation != ConfirmReplyAndPoll {
+		return nil
+	}
+
+	err = poll()
+	if err != nil {
+		return err
+	}
+
+	return check()
+}
+
+// checkACChange compares the decoded AC against the fields a change sets.
+func (a *AirTouch) checkACChange(change ACChange) error {
+	if change.Power != "" && a.AC.PowerState != change.Power {
+		return &MismatchError{Command: "ACControl", Field: "PowerState", Requested: change.Power, Actual: a.AC.PowerState}
+	}
+
+	// The mode of an AC that has been turned off is not meaningful.
+	if change.Mode != "" && a.AC.PowerState == "On" && a.AC.AcMode != change.Mode {
+		return &MismatchError{Command: "ACControl", Field: "AcMode", Requested: change.Mode, Actual: a.AC.AcMode}
+	}
+
+	if change.FanSpeed != "" && a.AC.AcFanSpeed != change.FanSpeed {
+		return &MismatchError{Command: "ACControl", Field: "AcFanSpeed", Requested: change.FanSpeed, Actual: a.AC.AcFanSpeed}
+	}
+
+	if change.TargetSetpoint != "" && strconv.Itoa(a.AC.AcTargetSetpoint) != change.TargetSetpoint {
+		return &MismatchError{Command: "ACControl", Field: "AcTargetSetpoint", Requested: change.TargetSetpoint, Actual: strconv.Itoa(a.AC.AcTargetSetpoint)}
+	}
+
+	return nil
+}
+
+// checkGroupChange compares the decoded groups against a requested group change.
+func (a *AirTouch) checkGroupChange(change GroupChange) error {
+	groupNumber, _ := strconv.Atoi(change.Group)
+
+	group := a.groupByNumber(groupNumber)
+	if group == nil {
+		return &MismatchError{Command: "GroupControl", Group: change.Group, Field: "Group", Requested: change.Group, Actual: "missing"}
+	}
+
+	if change.Power != "" && group.PowerState != change.Power {
+		return &MismatchError{Command: "GroupControl", Group: change.Group, Field: "PowerState", Requested: change.Power, Actual: group.PowerState}
+	}
+
+	if change.TargetSetpoint != "" {
+		if group.ControlMethod != "TemperatureControl" {
+			return &MismatchError{Command: "GroupControl", Group: change.Group, Field: "ControlMethod", Requested: "TemperatureControl", Actual: group.ControlMethod}
+		}
+
+		if targetSetpoint, _ := strconv.Atoi(change.TargetSetpoint); group.TargetSetpoint != targetSetpoint {
+			return &MismatchError{Command: "GroupControl", Group: change.Group, Field: "TargetSetpoint", Requested: change.TargetSetpoint, Actual: strconv.Itoa(group.TargetSetpoint)}
+		}
+	}
+
+	if change.OpenPercentage != "" {
+		if group.ControlMethod != "PercentageControl" {
+			return &MismatchError{Command: "GroupControl", Group: change.Group, Field: "ControlMethod", Requested: "PercentageControl", Actual: group.ControlMethod}
+		}
+
+		// Spill groups report the percentage the console opened them to, not the one requested,
+		// and groups that are off report 0.
+		openPercentage, _ := strconv.Atoi(change.OpenPercentage)
+		if !group.Spill && group.PowerState != "Off" && group.OpenPercentage != openPercentage {
+			return &MismatchError{Command: "GroupControl", Group: change.Group, Field: "OpenPercentage", Requested: change.OpenPercentage, Actual: strconv.Itoa(group.OpenPercentage)}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package airtouch
+
+import (
+	"errors"
+	"testing"
+)
+
+// acStatusReply is an AC status reply for an AC that is on, in Cool mode at 22 degrees.
+var acStatusReply = replyFrame(ACStatusType, []byte{0x40, 0x42, 0x16, 0x00, 0x5b, 0x60, 0x00, 0x00})
+
+// acStatusFanReply is an AC status reply for an AC that is on, in Fan mode at 22 degrees.
+var acStatusFanReply = replyFrame(ACStatusType, []byte{0x40, 0x32, 0x16, 0x00, 0x5b, 0x60, 0x00, 0x00})
+
+// groupStatusReply is a group status reply with group 0 on at 22 degrees under temperature
+// control and group 1 on at 50% under percentage control.
+var groupStatusReply = replyFrame(GroupStatusType, []byte{
+	0x40, 0xbc, 0x16, 0x80, 0x5b, 0xc0,
+	0x41, 0x32, 0x16, 0x00, 0x5b, 0xc0,
+})
+
+func TestConfirmACState(t *testing.T) {
+	a := fakeConsole(t, func(request []byte) []byte {
+		return acStatusReply
+	})
+
+	if err := a.SetACState("On", "Cool"); err != nil {
+		t.Errorf("expected Cool to be confirmed, got %v", err)
+	}
+
+	err := a.SetACState("On", "Heat")
+
+	var mismatchErr *MismatchError
+	if !errors.As(err, &mismatchErr) || mismatchErr.Field != "AcMode" || mismatchErr.Actual != "Cool" {
+		t.Errorf("expected an AcMode MismatchError, got %v", err)
+	}
+
+	if !errors.Is(err, ErrRejected) {
+		t.Errorf("expected %v to match ErrRejected", err)
+	}
+
+	a.Confirmation = ConfirmNone
+	if err := a.SetACState("On", "Heat"); err != nil {
+		t.Errorf("expected no confirmation, got %v", err)
+	}
+}
+
+func TestConfirmACStateWithPoll(t *testing.T) {
+	requests := 0
+	a := fakeConsole(t, func(request []byte) []byte {
+		requests++
+		if requests == 1 {
+			return acStatusReply
+		}
+
+		// The console reverted the change by the time it was polled.
+		return acStatusFanReply
+	})
+	a.Confirmation = ConfirmReplyAndPoll
+
+	err := a.SetACState("On", "Cool")
+
+	var mismatchErr *MismatchError
+	if !errors.As(err, &mismatchErr) || mismatchErr.Actual != "Fan" {
+		t.Errorf("expected the poll to find Fan, got %v", err)
+	}
+
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+}
+
+func TestConfirmGroupTemperature(t *testing.T) {
+	a := fakeConsole(t, func(request []byte) []byte {
+		return groupStatusReply
+	})
+
+	if err := a.SetGroupToTemperature("0", "22"); err != nil {
+		t.Errorf("expected group 0 to be confirmed, got %v", err)
+	}
+
+	tests := []struct {
+		groupNumber string
+		temperature string
+		field       string
+	}{
+		{"0", "21", "TargetSetpoint"},
+		{"1", "22", "ControlMethod"},
+	}
+
+	for _, test := range tests {
+		err := a.SetGroupToTemperature(test.groupNumber, test.temperature)
+
+		var mismatchErr *MismatchError
+		if !errors.As(err, &mismatchErr) || mismatchErr.Field != test.field {
+			t.Errorf("group %s: expected a %s MismatchError, got %v", test.groupNumber, test.field, err)
+		}
+	}
+
+	// Groups missing from the last reply are now rejected before anything is sent.
+	if err := a.SetGroupToTemperature("2", "22"); !errors.Is(err, ErrValidation) {
+		t.Errorf("group 2: expected ErrValidation, got %v", err)
+	}
+}
+
+func TestConfirmationValidation(t *testing.T) {
+	a := AirTouch{Confirmation: "Sometimes"}
+
+	if err := a.SetACState("On", "Cool"); !errors.Is(err, ErrValidation) {
+		t.Errorf("expected ErrValidation, got %v", err)
+	}
+}
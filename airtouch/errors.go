@@ -0,0 +1,140 @@
+package airtouch
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+var (
+	// ErrConnection is matched by errors that stop the console from being reached or that break
+	// the connection part way through a request.
+	ErrConnection = errors.New("airtouch: connection failed")
+	// ErrTimeout is matched by connection errors caused by the console not responding in time.
+	ErrTimeout = errors.New("airtouch: timeout")
+	// ErrFraming is matched by replies that are not a well formed AirTouch 4 frame.
+	ErrFraming = errors.New("airtouch: malformed frame")
+	// ErrCRC is matched by replies whose CRC does not match their contents.
+	ErrCRC = errors.New("airtouch: crc mismatch")
+	// ErrDecode is matched by replies whose data cannot be decoded into groups or the AC.
+	ErrDecode = errors.New("airtouch: decode failed")
+	// ErrValidation is matched by arguments that cannot be turned into a control message.
+	ErrValidation = errors.New("airtouch: invalid argument")
+	// ErrRejected is matched by control messages the console did not act on.
+	ErrRejected = errors.New("airtouch: command rejected")
+	// ErrShortCycle is matched by AC state changes blocked to protect the compressor.
+	ErrShortCycle = errors.New("airtouch: compressor short cycle")
+)
+
+// ConnectionError records a failure talking to the console. It matches ErrConnection, and
+// ErrTimeout as well when the underlying network error is a timeout.
+type ConnectionError struct {
+	Op      string
+	Address string
+	Err     error
+}
+
+func (e *ConnectionError) Error() string {
+	return fmt.Sprintf("airtouch: %s %s: %s", e.Op, e.Address, e.Err)
+}
+
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches ErrConnection and, for network timeouts, ErrTimeout.
+func (e *ConnectionError) Is(target error) bool {
+	if target == ErrConnection {
+		return true
+	}
+
+	var netErr net.Error
+	return target == ErrTimeout && errors.As(e.Err, &netErr) && netErr.Timeout()
+}
+
+// FrameError records a reply that could not be split into header, data and CRC. It matches
+// ErrFraming.
+type FrameError struct {
+	Reason string
+	Frame  []byte
+}
+
+func (e *FrameError) Error() string {
+	return fmt.Sprintf("airtouch: malformed frame: %s", e.Reason)
+}
+
+// Is matches ErrFraming.
+func (e *FrameError) Is(target error) bool {
+	return target == ErrFraming
+}
+
+// CRCError records a reply whose CRC does not match. It matches ErrCRC.
+type CRCError struct {
+	Expected uint16
+	Actual   uint16
+}
+
+func (e *CRCError) Error() string {
+	return fmt.Sprintf("airtouch: crc mismatch: expected %04x, got %04x", e.Expected, e.Actual)
+}
+
+// Is matches ErrCRC.
+func (e *CRCError) Is(target error) bool {
+	return target == ErrCRC
+}
+
+// DecodeError records a field that could not be decoded from a reply. It matches ErrDecode.
+type DecodeError struct {
+	Message string
+	Field   string
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("airtouch: decoding %s: %s", e.Message, e.Err)
+	}
+
+	return fmt.Sprintf("airtouch: decoding %s %s: %s", e.Message, e.Field, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches ErrDecode.
+func (e *DecodeError) Is(target error) bool {
+	return target == ErrDecode
+}
+
+// ValidationError records an argument that cannot be sent to the console. It matches
+// ErrValidation.
+type ValidationError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("airtouch: invalid %s %q: %s", e.Field, e.Value, e.Reason)
+}
+
+// Is matches ErrValidation.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// RejectedError records a control message the console did not act on. It matches ErrRejected.
+type RejectedError struct {
+	Command string
+	Reason  string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("airtouch: %s rejected: %s", e.Command, e.Reason)
+}
+
+// Is matches ErrRejected.
+func (e *RejectedError) Is(target error) bool {
+	return target == ErrRejected
+}
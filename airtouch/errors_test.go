@@ -0,0 +1,102 @@
+package airtouch
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestConnectionErrors(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().(*net.TCPAddr)
+	listener.Close()
+
+	a := AirTouch{IPAddress: addr.IP.String(), Port: addr.Port}
+	err = a.GetACStatus()
+
+	var connectionErr *ConnectionError
+	if !errors.As(err, &connectionErr) || connectionErr.Op != "dial" {
+		t.Fatalf("expected a dial ConnectionError, got %v", err)
+	}
+
+	if !errors.Is(err, ErrConnection) || errors.Is(err, ErrTimeout) {
+		t.Errorf("expected %v to match ErrConnection only", err)
+	}
+
+	timeout := &ConnectionError{Op: "read", Err: &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}}
+	if !errors.Is(timeout, ErrTimeout) || !errors.Is(timeout, os.ErrDeadlineExceeded) {
+		t.Errorf("expected %v to match ErrTimeout and the underlying cause", timeout)
+	}
+}
+
+func TestFrameErrors(t *testing.T) {
+	a := AirTouch{}
+	valid := replyFrame(0x2d, acStatusSeed)
+
+	corrupt := append([]byte{}, valid...)
+	corrupt[len(corrupt)-1] ^= 0xff
+
+	tests := []struct {
+		name     string
+		frame    []byte
+		expected error
+	}{
+		{"short", valid[:4], ErrFraming},
+		{"header", append([]byte{0x00}, valid[1:]...), ErrFraming},
+		{"truncated", valid[:len(valid)-3], ErrFraming},
+		{"crc", corrupt, ErrCRC},
+	}
+
+	for _, test := range tests {
+		_, err := a.TranslatePacketToMessage(test.frame)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	a := AirTouch{}
+
+	err := a.DecodeGroupStatusMessage(MessageOutput{Body: groupStatusSeed[:5]})
+	if !errors.Is(err, ErrDecode) {
+		t.Errorf("expected ErrDecode, got %v", err)
+	}
+
+	err = a.DecodeACStatusMessage(MessageOutput{Body: acStatusSeed[:5]})
+
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || decodeErr.Message != "ACStatus" {
+		t.Errorf("expected an ACStatus DecodeError, got %v", err)
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	a := AirTouch{}
+
+	for _, err := range []error{
+		a.SetACState("On", "Bogus"),
+		a.SetACState("Sideways", "Cool"),
+		a.SetGroupToTemperature("1", "300"),
+		a.SetGroupToTemperature("1", "warm"),
+	} {
+		if !errors.Is(err, ErrValidation) {
+			t.Errorf("expected ErrValidation, got %v", err)
+		}
+	}
+}
+
+func TestRejectedErrors(t *testing.T) {
+	a := fakeConsole(t, func(request []byte) []byte {
+		return replyFrame(GroupStatusType, groupStatusSeed)
+	})
+
+	err := a.SetACState("On", "Cool")
+	if !errors.Is(err, ErrRejected) {
+		t.Errorf("expected ErrRejected, got %v", err)
+	}
+}
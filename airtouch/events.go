@@ -0,0 +1,170 @@
+package airtouch
+
+import (
+	"time"
+)
+
+const (
+	// EventGroupPower is emitted when a group turns on, off or to turbo.
+	EventGroupPower = "GroupPower"
+	// EventGroupControlMethod is emitted when a group switches between percentage and
+	// temperature control.
+	EventGroupControlMethod = "GroupControlMethod"
+	// EventGroupSetpoint is emitted when a group's target setpoint changes.
+	EventGroupSetpoint = "GroupSetpoint"
+	// EventGroupOpenPercentage is emitted when a group that is on under percentage control opens
+	// or closes. Spill groups are left out as the console changes them itself.
+	EventGroupOpenPercentage = "GroupOpenPercentage"
+	// EventGroupSpill is emitted when a group starts or stops spilling.
+	EventGroupSpill = "GroupSpill"
+	// EventGroupBatteryLow is emitted when a group's sensor battery becomes low or is replaced.
+	EventGroupBatteryLow = "GroupBatteryLow"
+	// EventACPower is emitted when the AC turns on or off.
+	EventACPower = "ACPower"
+	// EventACMode is emitted when the AC mode changes.
+	EventACMode = "ACMode"
+	// EventACSetpoint is emitted when the AC target setpoint changes.
+	EventACSetpoint = "ACSetpoint"
+	// EventACSpill is emitted when the AC starts or stops spilling.
+	EventACSpill = "ACSpill"
+)
+
+// Event is a change between two successive snapshots of the AC or a group. Old and New hold the
+// changed attribute, typed as it is on AC or Group. Group and GroupName are only set for group
+// events.
+type Event struct {
+	Type      string
+	Group     int
+	GroupName string
+	Old       any
+	New       any
+	Time      time.Time
+}
+
+// Subscribe registers fn to receive every event. Events are delivered synchronously, after the
+// reply that caused them has been decoded and while the refresh that decoded it is still running,
+// so fn must queue any refresh or control call rather than make it. The returned function removes
+// the subscription.
+func (a *AirTouch) Subscribe(fn func(Event)) func() {
+	a.subscribersMu.Lock()
+	defer a.subscribersMu.Unlock()
+
+	if a.subscribers == nil {
+		a.subscribers = make(map[int]func(Event))
+	}
+
+	id := a.nextSubscriber
+	a.nextSubscriber++
+	a.subscribers[id] = fn
+
+	return func() {
+		a.subscribersMu.Lock()
+		defer a.subscribersMu.Unlock()
+
+		delete(a.subscribers, id)
+	}
+}
+
+// publish delivers events to every subscriber.
+func (a *AirTouch) publish(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	a.subscribersMu.Lock()
+	subscribers := make([]func(Event), 0, len(a.subscribers))
+	for _, fn := range a.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	a.subscribersMu.Unlock()
+
+	for _, event := range events {
+		a.logger().Debug("state changed", "type", event.Type, "group", event.GroupName, "old", event.Old, "new", event.New)
+
+		for _, fn := range subscribers {
+			fn(event)
+		}
+	}
+}
+
+// diffGroups returns the events between two group snapshots. Groups that only appear in one of
+// them are not compared.
+func diffGroups(old []Group, new []Group, now time.Time) []Event {
+	var events []Event
+
+	for _, n := range new {
+		for _, o := range old {
+			if o.Number != n.Number {
+				continue
+			}
+
+			event := func(eventType string, oldValue any, newValue any) {
+				events = append(events, Event{Type: eventType, Group: n.Number, GroupName: n.Name, Old: oldValue, New: newValue, Time: now})
+			}
+
+			if o.PowerState != n.PowerState {
+				event(EventGroupPower, o.PowerState, n.PowerState)
+			}
+
+			if o.ControlMethod != n.ControlMethod {
+				event(EventGroupControlMethod, o.ControlMethod, n.ControlMethod)
+			}
+
+			if o.TargetSetpoint != n.TargetSetpoint {
+				event(EventGroupSetpoint, o.TargetSetpoint, n.TargetSetpoint)
+			}
+
+			if o.OpenPercentage != n.OpenPercentage && percentageControlled(o) && percentageControlled(n) {
+				event(EventGroupOpenPercentage, o.OpenPercentage, n.OpenPercentage)
+			}
+
+			if o.Spill != n.Spill {
+				event(EventGroupSpill, o.Spill, n.Spill)
+			}
+
+			if o.BatteryLow != n.BatteryLow {
+				event(EventGroupBatteryLow, o.BatteryLow, n.BatteryLow)
+			}
+		}
+	}
+
+	return events
+}
+
+// percentageControlled returns true if a group's open percentage is set by hand rather than by
+// the console.
+func percentageControlled(g Group) bool {
+	return g.PowerState != "Off" && g.ControlMethod == "PercentageControl" && !g.Spill
+}
+
+// diffAC returns the events between two AC snapshots. Nothing is returned for the first
+// snapshot.
+func diffAC(old AC, new AC, now time.Time) []Event {
+	var events []Event
+
+	if old.PowerState == "" {
+		return nil
+	}
+
+	event := func(eventType string, oldValue any, newValue any) {
+		events = append(events, Event{Type: eventType, Old: oldValue, New: newValue, Time: now})
+	}
+
+	if old.PowerState != new.PowerState {
+		event(EventACPower, old.PowerState, new.PowerState)
+	}
+
+	if old.AcMode != new.AcMode {
+		event(EventACMode, old.AcMode, new.AcMode)
+	}
+
+	if old.AcTargetSetpoint != new.AcTargetSetpoint {
+		event(EventACSetpoint, old.AcTargetSetpoint, new.AcTargetSetpoint)
+	}
+
+	if old.Spill != new.Spill {
+		event(EventACSpill, old.Spill, new.Spill)
+	}
+
+	return events
+}
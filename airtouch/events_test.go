@@ -0,0 +1,90 @@
+package airtouch
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGroupEvents(t *testing.T) {
+	a := AirTouch{groupNames: map[int]string{0: "Living", 1: "Bed"}}
+
+	var events []Event
+	unsubscribe := a.Subscribe(func(event Event) {
+		events = append(events, event)
+	})
+
+	// The first snapshot has nothing to compare against.
+	if err := a.DecodeGroupStatusMessage(MessageOutput{Body: groupStatusSeed[:12]}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 0 {
+		t.Fatalf("expected no events for the first snapshot, got %+v", events)
+	}
+
+	changed := append([]byte{}, groupStatusSeed[:12]...)
+	changed[0] = 0x00  // Living turned off.
+	changed[8] = 0x95  // Bed setpoint from 23 to 21 and battery low.
+	changed[11] = 0x70 // Bed spilling.
+
+	if err := a.DecodeGroupStatusMessage(MessageOutput{Body: changed}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got [][]any
+	for _, event := range events {
+		got = append(got, []any{event.Type, event.GroupName, event.Old, event.New})
+	}
+
+	expected := [][]any{
+		{EventGroupPower, "Living", "On", "Off"},
+		{EventGroupSetpoint, "Bed", 23, 21},
+		{EventGroupSpill, "Bed", false, true},
+		{EventGroupBatteryLow, "Bed", false, true},
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	unsubscribe()
+	events = nil
+
+	if err := a.DecodeGroupStatusMessage(MessageOutput{Body: groupStatusSeed[:12]}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 0 {
+		t.Errorf("expected no events after unsubscribing, got %+v", events)
+	}
+}
+
+func TestACEvents(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	a := AirTouch{now: func() time.Time { return now }}
+
+	var events []Event
+	a.Subscribe(func(event Event) {
+		events = append(events, event)
+	})
+
+	if err := a.DecodeACStatusMessage(MessageOutput{Body: acStatusSeed}); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := append([]byte{}, acStatusSeed...)
+	changed[1] = 0x11 // Cool to Heat.
+
+	if err := a.DecodeACStatusMessage(MessageOutput{Body: changed}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 || events[0].Type != EventACMode || events[0].Old != "Cool" || events[0].New != "Heat" {
+		t.Errorf("expected a single Cool to Heat event, got %+v", events)
+	}
+
+	if len(events) == 1 && !events[0].Time.Equal(now) {
+		t.Errorf("expected the event at the client's clock %v, got %v", now, events[0].Time)
+	}
+}
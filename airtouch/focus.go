@@ -0,0 +1,160 @@
+package airtouch
+
+import (
+	"log/slog"
+	"sort"
+)
+
+// FocusGroup is the temperature RunACModeSwitchingPatch treats as the AC temperature.
+type FocusGroup struct {
+	// Name is the group the temperature came from, or a description of how it was combined.
+	Name string
+	// Diff is Temperature less the setpoint. Positive is warmer than the setpoint.
+	Diff        float64
+	Temperature float64
+}
+
+// FocusStrategy picks the focus group from the groups that are On and not unreliable. There is
+// always at least one group. heating is true when the AC is meant to be heating.
+type FocusStrategy func(groups []Group, heating bool, config PatchConfig) FocusGroup
+
+// FocusStrategyMap maps focus strategy names to the built in strategies and FocusStrategies.
+func (a *AirTouch) FocusStrategyMap() map[string]FocusStrategy {
+	m := make(map[string]FocusStrategy)
+
+	m["Worst"] = worstFocus
+	m["WeightedAverage"] = a.weightedAverageFocus
+	m["Master"] = a.masterFocus
+	m["Median"] = medianFocus
+
+	for name, strategy := range a.FocusStrategies {
+		m[name] = strategy
+	}
+
+	return m
+}
+
+// focusGroup filters out groups that are off or unreliable and runs the configured strategy.
+// Without any groups to focus on, a difference that satisfies the setpoint is returned.
+func (a *AirTouch) focusGroup(heating bool, config PatchConfig) FocusGroup {
+	var groups []Group
+
+	for _, g := range a.Groups {
+		if g.PowerState != "On" || a.unreliable(g, config) {
+			continue
+		}
+		groups = append(groups, g)
+	}
+
+	if len(groups) == 0 {
+		focus := FocusGroup{Name: "NA", Diff: -50.0}
+		if heating {
+			focus.Diff = 50.0
+		}
+		return focus
+	}
+
+	name := config.FocusStrategy
+	if name == "" {
+		name = "Worst"
+	}
+
+	focus := a.FocusStrategyMap()[name](groups, heating, config)
+
+	inputs := make([]any, 0, len(groups))
+	for _, g := range groups {
+		inputs = append(inputs, slog.Group(g.Name, "temperature", g.Temperature, "target_setpoint", g.TargetSetpoint))
+	}
+
+	a.logger().Info("focus group", "strategy", name, "heating", heating, "group", focus.Name, "diff", focus.Diff, "temperature", focus.Temperature, slog.Group("inputs", inputs...))
+
+	return focus
+}
+
+// unreliable returns true if a group is listed in UnreliableGroups.
+func (a *AirTouch) unreliable(g Group, config PatchConfig) bool {
+	for _, group := range config.UnreliableGroups {
+		if a.groupMatches(group, g) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// diff returns how far a group is from its setpoint.
+func diff(g Group) float64 {
+	return g.Temperature - float64(g.TargetSetpoint)
+}
+
+// worstFocus picks the group furthest above its setpoint when cooling, or below it when heating.
+func worstFocus(groups []Group, heating bool, config PatchConfig) FocusGroup {
+	worst := groups[0]
+
+	for _, g := range groups[1:] {
+		if (!heating && diff(g) > diff(worst)) || (heating && diff(g) < diff(worst)) {
+			worst = g
+		}
+	}
+
+	return FocusGroup{Name: worst.Name, Diff: diff(worst), Temperature: worst.Temperature}
+}
+
+// weightedAverageFocus averages the groups using FocusWeights, which default to 1.
+func (a *AirTouch) weightedAverageFocus(groups []Group, heating bool, config PatchConfig) FocusGroup {
+	var totalWeight, totalDiff, totalTemperature float64
+
+	for _, g := range groups {
+		weight := 1.0
+		for group, w := range config.FocusWeights {
+			if a.groupMatches(group, g) {
+				weight = w
+			}
+		}
+
+		totalWeight += weight
+		totalDiff += weight * diff(g)
+		totalTemperature += weight * g.Temperature
+	}
+
+	if totalWeight == 0 {
+		return worstFocus(groups, heating, config)
+	}
+
+	return FocusGroup{Name: "weighted average", Diff: totalDiff / totalWeight, Temperature: totalTemperature / totalWeight}
+}
+
+// masterFocus uses MasterGroup, falling back to the worst group while it is off or unreliable.
+func (a *AirTouch) masterFocus(groups []Group, heating bool, config PatchConfig) FocusGroup {
+	for _, g := range groups {
+		if a.groupMatches(config.MasterGroup, g) {
+			return FocusGroup{Name: g.Name, Diff: diff(g), Temperature: g.Temperature}
+		}
+	}
+
+	a.logger().Info("master group not available, using the worst group", "master_group", config.MasterGroup)
+
+	return worstFocus(groups, heating, config)
+}
+
+// medianFocus uses the group with the median difference, averaging the middle two of an even
+// number of groups.
+func medianFocus(groups []Group, heating bool, config PatchConfig) FocusGroup {
+	sorted := append([]Group(nil), groups...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return diff(sorted[i]) < diff(sorted[j])
+	})
+
+	middle := sorted[len(sorted)/2]
+	if len(sorted)%2 == 1 {
+		return FocusGroup{Name: middle.Name, Diff: diff(middle), Temperature: middle.Temperature}
+	}
+
+	lower := sorted[len(sorted)/2-1]
+
+	return FocusGroup{
+		Name:        "median",
+		Diff:        (diff(lower) + diff(middle)) / 2,
+		Temperature: (lower.Temperature + middle.Temperature) / 2,
+	}
+}
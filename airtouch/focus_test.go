@@ -0,0 +1,99 @@
+package airtouch
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestFocusStrategies(t *testing.T) {
+	a := AirTouch{
+		Groups: []Group{
+			{Name: "Living", Number: 0, PowerState: "On", Temperature: 24, TargetSetpoint: 22},
+			{Name: "Bed", Number: 1, PowerState: "On", Temperature: 21, TargetSetpoint: 22},
+			{Name: "Study", Number: 2, PowerState: "On", Temperature: 23, TargetSetpoint: 22},
+			{Name: "Hall", Number: 3, PowerState: "On", Temperature: 30, TargetSetpoint: 22},
+			{Name: "Guest", Number: 4, PowerState: "Off", Temperature: 35, TargetSetpoint: 22},
+		},
+		FocusStrategies: map[string]FocusStrategy{
+			"Coldest": func(groups []Group, heating bool, config PatchConfig) FocusGroup {
+				return worstFocus(groups, true, config)
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		heating bool
+		modify  func(*PatchConfig)
+		group   string
+		diff    float64
+	}{
+		{"worst cooling", false, func(c *PatchConfig) {}, "Living", 2},
+		{"worst heating", true, func(c *PatchConfig) {}, "Bed", -1},
+		{"weighted average", false, func(c *PatchConfig) {
+			c.FocusStrategy = "WeightedAverage"
+			c.FocusWeights = map[string]float64{"Living": 2}
+		}, "weighted average", 1},
+		{"master", false, func(c *PatchConfig) {
+			c.FocusStrategy = "Master"
+			c.MasterGroup = "2"
+		}, "Study", 1},
+		{"master off", false, func(c *PatchConfig) {
+			c.FocusStrategy = "Master"
+			c.MasterGroup = "Guest"
+		}, "Living", 2},
+		{"median", false, func(c *PatchConfig) {
+			c.FocusStrategy = "Median"
+		}, "Study", 1},
+		{"median even", false, func(c *PatchConfig) {
+			c.FocusStrategy = "Median"
+			c.UnreliableGroups = nil
+		}, "median", 1.5},
+		{"custom", false, func(c *PatchConfig) {
+			c.FocusStrategy = "Coldest"
+		}, "Bed", -1},
+	}
+
+	for _, test := range tests {
+		config := DefaultPatchConfig()
+		config.UnreliableGroups = []string{"Hall"}
+		test.modify(&config)
+
+		if err := a.SetPatchConfig(config); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		focus := a.focusGroup(test.heating, a.CurrentPatchConfig())
+		if focus.Name != test.group || math.Abs(focus.Diff-test.diff) > 1e-9 {
+			t.Errorf("%s: expected %s at %v, got %s at %v", test.name, test.group, test.diff, focus.Name, focus.Diff)
+		}
+	}
+}
+
+func TestFocusWithoutGroups(t *testing.T) {
+	a := AirTouch{Groups: []Group{{Name: "Living", PowerState: "Off"}}}
+
+	if focus := a.focusGroup(false, DefaultPatchConfig()); focus.Name != "NA" || focus.Diff != -50 {
+		t.Errorf("expected a satisfied cooling setpoint, got %+v", focus)
+	}
+
+	if focus := a.focusGroup(true, DefaultPatchConfig()); focus.Name != "NA" || focus.Diff != 50 {
+		t.Errorf("expected a satisfied heating setpoint, got %+v", focus)
+	}
+}
+
+func TestFocusStrategyValidation(t *testing.T) {
+	a := AirTouch{}
+
+	config := DefaultPatchConfig()
+	config.FocusStrategy = "Loudest"
+	if err := a.SetPatchConfig(config); !errors.Is(err, ErrValidation) {
+		t.Errorf("expected an unknown strategy to fail, got %v", err)
+	}
+
+	config.FocusStrategy = "Master"
+	if err := a.SetPatchConfig(config); !errors.Is(err, ErrValidation) {
+		t.Errorf("expected Master without a group to fail, got %v", err)
+	}
+}
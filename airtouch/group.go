@@ -1,7 +1,9 @@
 package airtouch
 
 import (
-	"log"
+	"strconv"
+
+	"github.com/elliotchance/orderedmap"
 )
 
 // Group models group attributes.
@@ -41,18 +43,191 @@ func (a *AirTouch) GroupStatusMap() map[string]string {
 	return m
 }
 
-// GetGroupData retrieves group data and sends to configured outputs.
+// GroupChange is a change to a single group. Empty fields are left unchanged on the console.
+type GroupChange struct {
+	// Group is a group number, name or alias.
+	Group string
+	// Power is one of On, Off or Turbo.
+	Power string
+	// TargetSetpoint switches the group to temperature control at this setpoint.
+	TargetSetpoint string
+	// OpenPercentage switches the group to percentage control at this percentage.
+	OpenPercentage string
+}
+
+// GroupPowerMap maps stringy group powers to their numerical value.
+func (a *AirTouch) GroupPowerMap() map[string]string {
+	m := make(map[string]string)
+
+	m["Off"] = "2"
+	m["On"] = "3"
+	m["Turbo"] = "5"
+
+	return m
+}
+
+// GroupControlMethodMap maps stringy group control methods to their numerical value.
+func (a *AirTouch) GroupControlMethodMap() map[string]string {
+	m := make(map[string]string)
+
+	m["PercentageControl"] = "2"
+	m["TemperatureControl"] = "3"
+
+	return m
+}
+
+// groupChangeToControlMessage builds the GroupControlMap entry for a single change.
+func (a *AirTouch) groupChangeToControlMessage(change GroupChange) (*orderedmap.OrderedMap, error) {
+	controlMessage := a.GroupControlMap()
+	controlMessage.Set("GroupNumber", change.Group)
+	controlMessage.Set("Power", "0")
+	controlMessage.Set("HaveTemperatureControl", "0")
+	controlMessage.Set("GroupSettingValue", "0")
+	controlMessage.Set("TargetSetpoint", "0")
+	controlMessage.Set("ZeroedByte", "0")
+
+	if change.Power != "" {
+		power, ok := a.GroupPowerMap()[change.Power]
+		if !ok {
+			return nil, &ValidationError{Field: "Power", Value: change.Power, Reason: "unknown power state"}
+		}
+		controlMessage.Set("Power", power)
+	}
+
+	if change.TargetSetpoint != "" && change.OpenPercentage != "" {
+		return nil, &ValidationError{Field: "TargetSetpoint", Value: change.TargetSetpoint, Reason: "cannot be set with OpenPercentage"}
+	}
+
+	if change.TargetSetpoint != "" {
+		controlMessage.Set("HaveTemperatureControl", a.GroupControlMethodMap()["TemperatureControl"])
+		controlMessage.Set("GroupSettingValue", "5") // Temperature rather than percentage
+		controlMessage.Set("TargetSetpoint", change.TargetSetpoint)
+	}
+
+	if change.OpenPercentage != "" {
+		controlMessage.Set("HaveTemperatureControl", a.GroupControlMethodMap()["PercentageControl"])
+		controlMessage.Set("GroupSettingValue", "4") // Percentage rather than temperature
+		controlMessage.Set("TargetSetpoint", change.OpenPercentage)
+	}
+
+	return controlMessage, nil
+}
+
+// SetGroups sends every change in a single GroupControl message and decodes the group status
+// reply. A group may only appear once, whether by number, name or alias.
+func (a *AirTouch) SetGroups(changes []GroupChange) error {
+	if len(changes) == 0 {
+		return &ValidationError{Field: "GroupChange", Reason: "no changes"}
+	}
+
+	err := a.validateConfirmation()
+	if err != nil {
+		return err
+	}
+
+	var controlMessages []*orderedmap.OrderedMap
+	var resolved []GroupChange
+	seen := make(map[int]bool)
+
+	for _, change := range changes {
+		number, err := a.ResolveGroup(change.Group)
+		if err != nil {
+			return err
+		}
+
+		if seen[number] {
+			return &ValidationError{Field: "Group", Value: change.Group, Reason: "changed more than once"}
+		}
+		seen[number] = true
+
+		err = a.validateGroupChange(number, change)
+		if err != nil {
+			return err
+		}
+
+		change.Group = strconv.Itoa(number)
+		resolved = append(resolved, change)
+
+		controlMessage, err := a.groupChangeToControlMessage(change)
+		if err != nil {
+			return err
+		}
+		controlMessages = append(controlMessages, controlMessage)
+	}
+
+	message, err := a.MessageObjectsToMessagePacket(GroupControl, controlMessages)
+	if err != nil {
+		return err
+	}
+
+	messageIn := MessageInput{
+		Message: *message,
+	}
+
+	a.recordGroupCommands(resolved)
+
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+
+	messageOut, err := a.CommunicateControlMessage("GroupControl", &messageIn, GroupStatusType, "changes", resolved)
+	if err != nil || messageOut == nil {
+		return err
+	}
+
+	err = a.DecodeGroupStatusMessage(*messageOut)
+	if err != nil {
+		return err
+	}
+
+	a.FixOpenPercentages()
+
+	return a.confirm(func() error {
+		for _, change := range resolved {
+			err := a.checkGroupChange(change)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}, a.GetGroupStatus)
+}
+
+// groupByNumber returns the group with the given number, or nil if there isn't one.
+func (a *AirTouch) groupByNumber(number int) *Group {
+	for i := range a.Groups {
+		if a.Groups[i].Number == number {
+			return &a.Groups[i]
+		}
+	}
+
+	return nil
+}
+
+// GetGroupData retrieves group data and sends to configured outputs. When CacheMaxAge is set,
+// a recent enough snapshot is served without querying the console.
 func (a *AirTouch) GetGroupData() error {
+	_, err := a.cached(cacheGroups, a.getGroupData)
+	return err
+}
+
+// GroupData refreshes the groups like GetGroupData and returns a copy of them. Unlike Groups, the
+// copy is safe to read while other goroutines refresh the groups.
+func (a *AirTouch) GroupData() ([]Group, error) {
+	entry, err := a.cached(cacheGroups, a.getGroupData)
+	return entry.groups, err
+}
+
+func (a *AirTouch) getGroupData() (cacheEntry, error) {
 	// Group status needs to go first so that AC groups are created.
 	err := a.GetGroupStatus()
 	if err != nil {
-		return err
+		return cacheEntry{}, err
 	}
 
 	// Add the group names and numbers to the AC groups.
 	err = a.GetGroupName()
 	if err != nil {
-		return err
+		return cacheEntry{}, err
 	}
 
 	// Groups that are off still report their last OpenPercentage :(
@@ -60,19 +235,10 @@ func (a *AirTouch) GetGroupData() error {
 	a.FixOpenPercentages()
 
 	for _, group := range a.Groups {
-		log.Printf("Name: %s", group.Name)
-		log.Printf("Number: %d", group.Number)
-		log.Printf("PowerState: %s", group.PowerState)
-		log.Printf("Temperature: %.1f", group.Temperature)
-		log.Printf("ControlMethod: %s", group.ControlMethod)
-		log.Printf("TargetSetpoint: %d", group.TargetSetpoint)
-		log.Printf("OpenPercentage: %d", group.OpenPercentage)
-		log.Printf("Spill: %t", group.Spill)
-		log.Printf("SpillPct: %d", group.SpillPercentage)
-		log.Printf("--------------------------------------------------")
+		a.logger().Info("group data", "group", group)
 	}
 
-	return nil
+	return cacheEntry{groups: append([]Group(nil), a.Groups...)}, nil
 }
 
 // GetGroupName sends a message to get group names.
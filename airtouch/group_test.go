@@ -0,0 +1,64 @@
+package airtouch
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSetGroupsSingleFrame(t *testing.T) {
+	var requests [][]byte
+	a := fakeConsole(t, func(request []byte) []byte {
+		requests = append(requests, request)
+		return replyFrame(GroupStatusType, []byte{
+			0x40, 0xbc, 0x16, 0x80, 0x5b, 0xc0,
+			0x41, 0x32, 0x16, 0x00, 0x5b, 0xc0,
+			0x02, 0x00, 0x15, 0x80, 0x5b, 0xc0,
+		})
+	})
+
+	err := a.SetGroups([]GroupChange{
+		{Group: "0", Power: "On", TargetSetpoint: "22"},
+		{Group: "1", Power: "On", OpenPercentage: "50"},
+		{Group: "2", Power: "Off"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+
+	request := requests[0]
+	expected := []byte{
+		0x00, 0x0c,
+		0x00, 0xbb, 0x16, 0x00,
+		0x01, 0x93, 0x32, 0x00,
+		0x02, 0x02, 0x00, 0x00,
+	}
+
+	if !bytes.Equal(request[6:len(request)-2], expected) {
+		t.Errorf("expected data %x, got %x", expected, request[6:len(request)-2])
+	}
+
+	if len(a.Groups) != 3 || a.Groups[2].PowerState != "Off" {
+		t.Errorf("expected the combined reply to be decoded, got %+v", a.Groups)
+	}
+}
+
+func TestSetGroupsValidation(t *testing.T) {
+	a := AirTouch{}
+
+	for _, changes := range [][]GroupChange{
+		nil,
+		{{Group: "1", Power: "Sideways"}},
+		{{Group: "1", TargetSetpoint: "22", OpenPercentage: "50"}},
+		{{Group: "1", Power: "On"}, {Group: "1", Power: "Off"}},
+		{{Group: "1", TargetSetpoint: "300"}},
+	} {
+		if err := a.SetGroups(changes); !errors.Is(err, ErrValidation) {
+			t.Errorf("%+v: expected ErrValidation, got %v", changes, err)
+		}
+	}
+}
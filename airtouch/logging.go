@@ -0,0 +1,106 @@
+package airtouch
+
+import (
+	"context"
+	"encoding/hex"
+	"log/slog"
+)
+
+// LevelTrace is below slog.LevelDebug and enables hex dumps of every frame sent to and
+// received from the console.
+const LevelTrace = slog.Level(-8)
+
+// logger returns the configured logger, falling back to the slog default logger.
+func (a *AirTouch) logger() *slog.Logger {
+	if a.Log != nil {
+		return a.Log
+	}
+
+	return slog.Default()
+}
+
+// tracing returns true if the logger has the protocol trace level enabled.
+func (a *AirTouch) tracing() bool {
+	return a.logger().Enabled(context.Background(), LevelTrace)
+}
+
+// trace logs msg at the protocol trace level.
+func (a *AirTouch) trace(msg string, args ...any) {
+	a.logger().Log(context.Background(), LevelTrace, msg, args...)
+}
+
+// traceFrame hex dumps a raw frame along with its header, address, ID, type, length, data and
+// CRC fields. Frames shorter than a header are dumped without the field breakdown.
+func (a *AirTouch) traceFrame(direction string, frame []byte) {
+	if !a.tracing() {
+		return
+	}
+
+	args := []any{
+		slog.String("direction", direction),
+		slog.Int("size", len(frame)),
+	}
+
+	if len(frame) >= 8 {
+		args = append(args,
+			slog.String("header", hex.EncodeToString(frame[0:2])),
+			slog.String("address", hex.EncodeToString(frame[2:4])),
+			slog.String("id", hex.EncodeToString(frame[4:5])),
+			slog.String("type", hex.EncodeToString(frame[5:6])),
+			slog.String("length", hex.EncodeToString(frame[6:8])),
+		)
+
+		dataLength := int(frame[6])<<8 | int(frame[7])
+		if len(frame) >= 8+dataLength+2 {
+			args = append(args,
+				slog.String("data", hex.EncodeToString(frame[8:8+dataLength])),
+				slog.String("crc", hex.EncodeToString(frame[8+dataLength:8+dataLength+2])),
+			)
+		}
+	}
+
+	args = append(args, slog.String("dump", hex.Dump(frame)))
+
+	a.trace("frame", args...)
+}
+
+// LogValue implements slog.LogValuer so a group is logged as structured fields.
+func (g Group) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("name", g.Name),
+		slog.Int("number", g.Number),
+		slog.String("power_state", g.PowerState),
+		slog.Float64("temperature", g.Temperature),
+		slog.String("control_method", g.ControlMethod),
+		slog.Int("target_setpoint", g.TargetSetpoint),
+		slog.Int("open_percentage", g.OpenPercentage),
+		slog.Bool("spill", g.Spill),
+		slog.Int("spill_percentage", g.SpillPercentage),
+	)
+}
+
+// LogValue implements slog.LogValuer so the AC is logged as structured fields.
+func (ac AC) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("power_state", ac.PowerState),
+		slog.String("mode", ac.AcMode),
+		slog.Int("target_setpoint", ac.AcTargetSetpoint),
+		slog.Float64("temperature", ac.Temperature),
+		slog.Bool("spill", ac.Spill),
+	)
+}
+
+// LogValue implements slog.LogValuer so the patch config is logged as structured fields.
+func (c PatchConfig) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Float64("cooling_tolerance", c.CoolingTolerance),
+		slog.Float64("heating_tolerance", c.HeatingTolerance),
+		slog.Int("active_open_percentage", c.ActiveOpenPercentage),
+		slog.Any("allowed_modes", c.AllowedModes),
+		slog.String("fallback_mode", c.FallbackMode),
+		slog.String("focus_strategy", c.FocusStrategy),
+		slog.String("master_group", c.MasterGroup),
+		slog.Any("unreliable_groups", c.UnreliableGroups),
+		slog.Int("overrides", len(c.Overrides)),
+	)
+}
@@ -0,0 +1,38 @@
+package airtouch
+
+import (
+	"bytes"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestTraceFrame(t *testing.T) {
+	var buf bytes.Buffer
+	a := AirTouch{
+		Log: slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: LevelTrace})),
+	}
+
+	frame, _ := hex.DecodeString("555580b0012b0000f52f")
+	a.traceFrame("sent", frame)
+
+	for _, expected := range []string{"address=80b0", "id=01", "type=2b", "length=0000", "crc=f52f"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected %q in %q", expected, buf.String())
+		}
+	}
+}
+
+func TestTraceFrameDisabled(t *testing.T) {
+	var buf bytes.Buffer
+	a := AirTouch{
+		Log: slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+
+	a.traceFrame("sent", []byte{0x55, 0x55})
+
+	if buf.Len() != 0 {
+		t.Errorf("expected no output, got %q", buf.String())
+	}
+}
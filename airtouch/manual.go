@@ -0,0 +1,399 @@
+package airtouch
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// commandLogWindow is how long a command explains the state changes that follow it. It
+	// covers confirmation polls and the next refresh of a slow loop.
+	commandLogWindow = 10 * time.Minute
+
+	manualStateFile = "manual.json"
+)
+
+// Command is a change this client sent to the console.
+type Command struct {
+	// Target is AC or a group number.
+	Target string
+	// Field is the Event type the change shows up as.
+	Field string
+	Value string
+	Time  time.Time
+}
+
+// ManualPause is automation paused on the AC or a group after a change this client didn't make,
+// such as one on the wall panel.
+type ManualPause struct {
+	// Target is AC or a group number.
+	Target string
+	Name   string
+	Field  string
+	Old    string
+	New    string
+	Until  time.Time
+}
+
+// manualState is kept in RootTempDir so that one-shot runs see the commands, pauses and state
+// of the runs before them.
+type manualState struct {
+	Commands []Command              `json:"commands"`
+	Pauses   map[string]ManualPause `json:"pauses"`
+	// AC and Groups are the last decoded state. They are compared against the first state a
+	// run decodes.
+	AC     AC      `json:"ac"`
+	Groups []Group `json:"groups"`
+}
+
+// Commands returns the commands sent within the last few minutes, oldest first.
+func (a *AirTouch) Commands() []Command {
+	a.manualMu.Lock()
+	defer a.manualMu.Unlock()
+
+	a.loadManualState()
+	a.pruneCommands()
+
+	return append([]Command(nil), a.manual.Commands...)
+}
+
+// Pauses returns the automation pauses in place, by target.
+func (a *AirTouch) Pauses() []ManualPause {
+	a.manualMu.Lock()
+	defer a.manualMu.Unlock()
+
+	a.loadManualState()
+	now := a.clock()
+
+	var pauses []ManualPause
+	for target, pause := range a.manual.Pauses {
+		if !now.Before(pause.Until) {
+			delete(a.manual.Pauses, target)
+			continue
+		}
+		pauses = append(pauses, pause)
+	}
+
+	sort.Slice(pauses, func(i, j int) bool {
+		return pauses[i].Target < pauses[j].Target
+	})
+
+	return pauses
+}
+
+// Paused returns the pause on a target, AC or a group number, name or alias, if automations
+// should leave it alone.
+func (a *AirTouch) Paused(target string) (ManualPause, bool) {
+	key := strings.TrimSpace(target)
+
+	if !strings.EqualFold(key, ScheduleTargetAC) {
+		for _, g := range a.Groups {
+			if a.groupMatches(key, g) {
+				key = strconv.Itoa(g.Number)
+				break
+			}
+		}
+	} else {
+		key = ScheduleTargetAC
+	}
+
+	for _, pause := range a.Pauses() {
+		if pause.Target == key {
+			return pause, true
+		}
+	}
+
+	return ManualPause{}, false
+}
+
+// ClearPause resumes automations on a target before its hold period ends.
+func (a *AirTouch) ClearPause(target string) {
+	pause, ok := a.Paused(target)
+	if !ok {
+		return
+	}
+
+	a.manualMu.Lock()
+	defer a.manualMu.Unlock()
+
+	delete(a.manual.Pauses, pause.Target)
+	a.saveManualState()
+	a.logger().Info("automation resumed", "target", pause.Target, "name", pause.Name)
+}
+
+// recordGroupCommands adds the fields group changes set to the command log.
+func (a *AirTouch) recordGroupCommands(changes []GroupChange) {
+	var commands []Command
+
+	for _, change := range changes {
+		if change.Power != "" {
+			commands = append(commands, Command{Target: change.Group, Field: EventGroupPower, Value: change.Power})
+		}
+
+		if change.TargetSetpoint != "" {
+			commands = append(commands,
+				Command{Target: change.Group, Field: EventGroupControlMethod, Value: "TemperatureControl"},
+				Command{Target: change.Group, Field: EventGroupSetpoint, Value: change.TargetSetpoint},
+			)
+		}
+
+		if change.OpenPercentage != "" {
+			commands = append(commands,
+				Command{Target: change.Group, Field: EventGroupControlMethod, Value: "PercentageControl"},
+				Command{Target: change.Group, Field: EventGroupOpenPercentage, Value: change.OpenPercentage},
+			)
+		}
+	}
+
+	a.recordCommands(commands)
+}
+
+// recordACCommands adds the fields an AC change sets to the command log.
+func (a *AirTouch) recordACCommands(change ACChange) {
+	var commands []Command
+
+	if change.Power != "" {
+		commands = append(commands, Command{Target: ScheduleTargetAC, Field: EventACPower, Value: change.Power})
+	}
+
+	if change.Mode != "" {
+		commands = append(commands, Command{Target: ScheduleTargetAC, Field: EventACMode, Value: change.Mode})
+	}
+
+	if change.TargetSetpoint != "" {
+		commands = append(commands, Command{Target: ScheduleTargetAC, Field: EventACSetpoint, Value: change.TargetSetpoint})
+	}
+
+	a.recordCommands(commands)
+}
+
+// recordCommands adds commands to the log before they are sent. Nothing is sent in DryRun.
+// Commands for values the target already has make no change, so they are left out rather than
+// kept around to explain a later change.
+func (a *AirTouch) recordCommands(commands []Command) {
+	if a.DryRun || a.ManualHold == 0 {
+		return
+	}
+
+	a.manualMu.Lock()
+	defer a.manualMu.Unlock()
+
+	a.loadManualState()
+	now := a.clock()
+
+	for _, command := range commands {
+		if a.currentValue(command.Target, command.Field) == command.Value {
+			continue
+		}
+
+		command.Time = now
+		a.manual.Commands = append(a.manual.Commands, command)
+	}
+
+	a.pruneCommands()
+	a.saveManualState()
+}
+
+// currentValue returns the decoded value of the field a command changes, as it appears in
+// events.
+func (a *AirTouch) currentValue(target string, field string) string {
+	switch field {
+	case EventACPower:
+		return a.AC.PowerState
+	case EventACMode:
+		// The mode of an AC that is off is not reported as changing.
+		if a.AC.PowerState != "On" {
+			return ""
+		}
+		return a.AC.AcMode
+	case EventACSetpoint:
+		return strconv.Itoa(a.AC.AcTargetSetpoint)
+	}
+
+	number, err := strconv.Atoi(target)
+	if err != nil {
+		return ""
+	}
+
+	group := a.groupByNumber(number)
+	if group == nil {
+		return ""
+	}
+
+	switch field {
+	case EventGroupPower:
+		return group.PowerState
+	case EventGroupControlMethod:
+		return group.ControlMethod
+	case EventGroupSetpoint:
+		return strconv.Itoa(group.TargetSetpoint)
+	case EventGroupOpenPercentage:
+		if !percentageControlled(*group) {
+			return ""
+		}
+		return strconv.Itoa(group.OpenPercentage)
+	}
+
+	return ""
+}
+
+// pruneCommands drops commands older than commandLogWindow. a.manualMu must be held.
+func (a *AirTouch) pruneCommands() {
+	cutoff := a.clock().Add(-commandLogWindow)
+
+	i := 0
+	for i < len(a.manual.Commands) && a.manual.Commands[i].Time.Before(cutoff) {
+		i++
+	}
+
+	a.manual.Commands = a.manual.Commands[i:]
+}
+
+// detectManualACChanges detects manual changes in a decoded AC status. The first status a run
+// decodes is compared against the last one the run before it decoded.
+func (a *AirTouch) detectManualACChanges(old AC, events []Event) {
+	if a.ManualHold == 0 {
+		return
+	}
+
+	a.manualMu.Lock()
+	defer a.manualMu.Unlock()
+
+	a.loadManualState()
+
+	if old.PowerState == "" {
+		events = diffAC(a.manual.AC, a.AC, a.clock())
+	}
+
+	a.manual.AC = a.AC
+	a.detectManualChanges(events)
+	a.saveManualState()
+}
+
+// detectManualGroupChanges detects manual changes in a decoded group status. The first status a
+// run decodes is compared against the last one the run before it decoded.
+func (a *AirTouch) detectManualGroupChanges(old []Group, events []Event) {
+	if a.ManualHold == 0 {
+		return
+	}
+
+	a.manualMu.Lock()
+	defer a.manualMu.Unlock()
+
+	a.loadManualState()
+
+	if len(old) == 0 {
+		events = diffGroups(a.manual.Groups, a.Groups, a.clock())
+	}
+
+	a.manual.Groups = append([]Group(nil), a.Groups...)
+	a.detectManualChanges(events)
+	a.saveManualState()
+}
+
+// detectManualChanges pauses automations on the targets of events that no logged command
+// explains. A command explains one change only. Only changes this client can make are compared.
+// a.manualMu must be held.
+func (a *AirTouch) detectManualChanges(events []Event) {
+	a.pruneCommands()
+
+	for _, event := range events {
+		target := strconv.Itoa(event.Group)
+
+		switch event.Type {
+		case EventGroupPower, EventGroupControlMethod, EventGroupSetpoint, EventGroupOpenPercentage:
+		case EventACPower, EventACMode, EventACSetpoint:
+			target = ScheduleTargetAC
+		default:
+			continue
+		}
+
+		value := fmt.Sprint(event.New)
+
+		if a.consumeCommand(target, event.Type, value) {
+			continue
+		}
+
+		name := event.GroupName
+		if target == ScheduleTargetAC {
+			name = ScheduleTargetAC
+		}
+
+		pause := ManualPause{
+			Target: target,
+			Name:   name,
+			Field:  event.Type,
+			Old:    fmt.Sprint(event.Old),
+			New:    value,
+			Until:  a.clock().Add(a.ManualHold),
+		}
+
+		if a.manual.Pauses == nil {
+			a.manual.Pauses = make(map[string]ManualPause)
+		}
+		a.manual.Pauses[target] = pause
+
+		a.logger().Info("manual change detected, pausing automation", "target", target, "name", name, "field", event.Type, "old", pause.Old, "new", pause.New, "until", pause.Until)
+	}
+}
+
+// consumeCommand removes the latest logged command that made a change. a.manualMu must be held.
+func (a *AirTouch) consumeCommand(target string, field string, value string) bool {
+	for i := len(a.manual.Commands) - 1; i >= 0; i-- {
+		command := a.manual.Commands[i]
+		if command.Target == target && command.Field == field && command.Value == value {
+			a.manual.Commands = append(a.manual.Commands[:i], a.manual.Commands[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadManualState reads the state kept by earlier runs the first time it is needed.
+// a.manualMu must be held.
+func (a *AirTouch) loadManualState() {
+	if a.manualLoaded {
+		return
+	}
+	a.manualLoaded = true
+
+	if a.RootTempDir == "" {
+		return
+	}
+
+	value, err := a.ReadStringFromFile(manualStateFile)
+	if err != nil {
+		return
+	}
+
+	var state manualState
+	err = json.Unmarshal([]byte(value), &state)
+	if err != nil {
+		a.logger().Warn("ignoring unreadable manual change state", "error", err)
+		return
+	}
+
+	a.manual = state
+}
+
+// saveManualState persists the command log, pauses and last decoded state. a.manualMu must be
+// held.
+func (a *AirTouch) saveManualState() {
+	if a.RootTempDir == "" {
+		return
+	}
+
+	data, err := json.Marshal(a.manual)
+	if err == nil {
+		err = a.WriteValueToFile(manualStateFile, string(data))
+	}
+
+	if err != nil {
+		a.logger().Warn("unable to save manual change state", "error", err)
+	}
+}
@@ -0,0 +1,243 @@
+package airtouch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManualChangeDetection(t *testing.T) {
+	now := time.Date(2024, 7, 1, 8, 0, 0, 0, time.UTC)
+	a := &AirTouch{ManualHold: time.Hour, now: func() time.Time { return now }}
+
+	groups := func(power byte, setpoint byte) MessageOutput {
+		body := append([]byte{}, groupStatusSeed...)
+		body[0] = power
+		body[2] = setpoint
+		return MessageOutput{Body: body}
+	}
+
+	ac := func(power byte) MessageOutput {
+		body := append([]byte{}, acStatusSeed...)
+		body[0] = power
+		return MessageOutput{Body: body}
+	}
+
+	decode := func(groupStatus MessageOutput, acStatus MessageOutput) {
+		t.Helper()
+		if err := a.DecodeGroupStatusMessage(groupStatus); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.DecodeACStatusMessage(acStatus); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	decode(groups(0x40, 0x16), ac(0x40))
+
+	// Changes this client commanded don't pause anything.
+	a.recordGroupCommands([]GroupChange{{Group: "0", TargetSetpoint: "24"}})
+	a.recordACCommands(ACChange{Power: "Off", Mode: "Cool"})
+	decode(groups(0x40, 0x18), ac(0x00))
+
+	if pauses := a.Pauses(); len(pauses) != 0 {
+		t.Fatalf("expected no pauses, got %+v", pauses)
+	}
+
+	// A command only explains one change, so setting it back on the wall panel is manual.
+	now = now.Add(time.Minute)
+	decode(groups(0x40, 0x16), ac(0x40))
+
+	pause, ok := a.Paused("0")
+	if !ok || pause.Target != "0" || pause.Field != EventGroupSetpoint || pause.Old != "24" || pause.New != "22" || !pause.Until.Equal(now.Add(time.Hour)) {
+		t.Errorf("expected group 0 to be paused for an hour, got %+v", pause)
+	}
+
+	if _, ok := a.Paused(ScheduleTargetAC); !ok {
+		t.Error("expected the AC to be paused")
+	}
+
+	if snapshot := a.Snapshot(); len(snapshot.Pauses) != 2 || snapshot.Pauses[0].Target != "0" {
+		t.Errorf("expected the pauses in the snapshot, got %+v", snapshot.Pauses)
+	}
+
+	a.ClearPause("ac")
+	if _, ok := a.Paused(ScheduleTargetAC); ok {
+		t.Error("expected the AC pause to be cleared")
+	}
+
+	now = now.Add(time.Hour)
+	if pauses := a.Pauses(); len(pauses) != 0 {
+		t.Errorf("expected the pause to end after an hour, got %+v", pauses)
+	}
+
+	// A commanded AC setpoint is explained, one set on the wall panel is not.
+	a.ClearPause(ScheduleTargetAC)
+	a.recordACCommands(ACChange{TargetSetpoint: "24"})
+	setpoint := func(degrees byte) MessageOutput {
+		body := append([]byte{}, acStatusSeed...)
+		body[2] = degrees
+		return MessageOutput{Body: body}
+	}
+
+	if err := a.DecodeACStatusMessage(setpoint(0x18)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := a.Paused(ScheduleTargetAC); ok {
+		t.Error("expected the commanded AC setpoint not to pause")
+	}
+
+	if err := a.DecodeACStatusMessage(setpoint(0x15)); err != nil {
+		t.Fatal(err)
+	}
+
+	if pause, ok := a.Paused(ScheduleTargetAC); !ok || pause.Field != EventACSetpoint || pause.New != "21" {
+		t.Errorf("expected the AC to be paused after the setpoint change, got %+v", pause)
+	}
+
+	// Commands are only kept for a while.
+	a.recordACCommands(ACChange{Power: "Off", Mode: "Cool"})
+	now = now.Add(commandLogWindow + time.Minute)
+	if commands := a.Commands(); len(commands) != 0 {
+		t.Errorf("expected old commands to be dropped, got %+v", commands)
+	}
+}
+
+func TestManualPauseSkipsSchedule(t *testing.T) {
+	controls := 0
+	a := fakeConsole(t, func(request []byte) []byte {
+		switch request[5] {
+		case 0x1f:
+			return replyFrame(0x1f, groupNameSeed)
+		case 0x2a:
+			controls++
+			return groupStatusReply
+		case 0x2b:
+			return groupStatusReply
+		}
+		return acStatusReply
+	})
+	a.Confirmation = ConfirmNone
+	a.ManualHold = time.Hour
+
+	now := time.Date(2024, 7, 1, 8, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+
+	if err := a.GetGroupData(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Group 0 was turned off on the wall panel.
+	body := append([]byte{}, groupStatusSeed...)
+	body[0] = 0x00
+	if err := a.DecodeGroupStatusMessage(MessageOutput{Body: body}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := a.Paused("living"); !ok {
+		t.Fatal("expected the group to be paused by name")
+	}
+
+	s := Scheduler{AirTouch: a, now: func() time.Time { return now }}
+	err := s.SetPrograms([]Program{{Target: "0", Entries: []ScheduleEntry{{At: "07:00", Power: "On"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Tick(); err != nil {
+		t.Fatal(err)
+	}
+
+	if controls != 0 {
+		t.Errorf("expected the paused group to be skipped, got %d control messages", controls)
+	}
+
+	// A hold is a change made on purpose, so it is sent anyway.
+	if err := s.Hold("0", ScheduleEntry{Power: "On"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if controls != 1 {
+		t.Errorf("expected the hold to be sent, got %d control messages", controls)
+	}
+}
+
+func TestManualChangesAcrossRuns(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 7, 1, 8, 0, 0, 0, time.UTC)
+
+	// Each run is a new client, as in the one-shot program.
+	run := func(percentage byte, acPower byte) *AirTouch {
+		t.Helper()
+
+		a := &AirTouch{RootTempDir: dir, ManualHold: time.Hour, now: func() time.Time { return now }}
+
+		groups := append([]byte{}, groupStatusSeed...)
+		groups[7] = percentage
+		if err := a.DecodeGroupStatusMessage(MessageOutput{Body: groups}); err != nil {
+			t.Fatal(err)
+		}
+
+		ac := append([]byte{}, acStatusSeed...)
+		ac[0] = acPower
+		if err := a.DecodeACStatusMessage(MessageOutput{Body: ac}); err != nil {
+			t.Fatal(err)
+		}
+
+		return a
+	}
+
+	a := run(0x32, 0x40)
+	a.recordGroupCommands([]GroupChange{{Group: "1", OpenPercentage: "60"}})
+
+	// Only the percentage is logged, as the group is already under percentage control.
+	if commands := a.Commands(); len(commands) != 1 || commands[0].Field != EventGroupOpenPercentage {
+		t.Fatalf("expected a single percentage command, got %+v", commands)
+	}
+
+	now = now.Add(time.Minute)
+	a = run(0x3c, 0x40)
+
+	if pauses := a.Pauses(); len(pauses) != 0 {
+		t.Fatalf("expected the commanded change not to pause, got %+v", pauses)
+	}
+
+	// Closing the group and turning off the AC on the wall panel between runs.
+	now = now.Add(time.Minute)
+	a = run(0x1e, 0x00)
+
+	pause, ok := a.Paused("1")
+	if !ok || pause.Field != EventGroupOpenPercentage || pause.Old != "60" || pause.New != "30" {
+		t.Errorf("expected group 1 to be paused after the percentage change, got %+v", pause)
+	}
+
+	if _, ok := a.Paused(ScheduleTargetAC); !ok {
+		t.Error("expected the AC to be paused")
+	}
+
+	fired := map[string]int{}
+	e := RuleEngine{AirTouch: a}
+	for _, target := range []string{"0", "1"} {
+		target := target
+		err := e.Add(Rule{
+			Name:    "group" + target,
+			Trigger: Trigger{Type: TriggerEvent},
+			Actions: []Action{func(a *AirTouch, state *RuleState) error {
+				fired[target]++
+				return nil
+			}},
+			Targets: []string{target},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := e.HandleEvent(Event{Type: EventGroupPower}); err != nil {
+		t.Fatal(err)
+	}
+
+	if fired["0"] != 1 || fired["1"] != 0 {
+		t.Errorf("expected only the rule on the group that isn't paused to fire, got %v", fired)
+	}
+}
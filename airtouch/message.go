@@ -5,7 +5,6 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
-	"log"
 	"net"
 	"strconv"
 	"strings"
@@ -25,12 +24,18 @@ const (
 	GroupStatus = "80b0012b0000"
 	// GroupName is used to query the group names.
 	GroupName = "90b0011f0002ff12"
+	// ACAbility is used to query the capabilities of the AC.
+	ACAbility = "90b0011f0002ff11"
 	// ACStatus is used to query the AC status attributes.
 	ACStatus = "80b0012d0000f4cf"
 	// ACControl is used to send messages to the AC.
 	ACControl = "2c"
 	// GroupControl is used to send messages to the AC to control groups.
 	GroupControl = "2a"
+	// GroupStatusType is the message type of group status replies.
+	GroupStatusType = 0x2b
+	// ACStatusType is the message type of AC status replies.
+	ACStatusType = 0x2d
 )
 
 // MessageOutput models the Airtouch 4 reply message.
@@ -46,31 +51,21 @@ type MessageOutput struct {
 func (a *AirTouch) PrepareMessage(message *MessageInput) error {
 	data, err := hex.DecodeString(message.Message)
 	if err != nil {
-		return err
+		return &ValidationError{Field: "message", Value: message.Message, Reason: err.Error()}
 	}
-	//a.Log.Info("fromHex = % x", data)
 
-	checksum := crc16.Checksum(&crc16.Conf{
-		Poly: 0x8005, BitRev: true,
-		IniVal: 0xffff, FinVal: 0x0,
-		BigEnd: false,
-	}, data)
-	//a.Log.Info("checksum = %d", checksum)
+	checksum := checksum(data)
 
 	b := make([]byte, 2)
 	binary.BigEndian.PutUint16(b, checksum)
 	//fmt.Println(string(b))
-	//a.Log.Info("b = %v", b)
 
 	encoded := hex.EncodeToString(b)
-	//a.Log.Info("encoded = %s", encoded)
 
 	// padded := fmt.Sprintf("%08x", encoded)
-	// a.Log.Info("padded = %s", padded)
 	// toCRC16 = 62767
 
 	message.MessageWithCRC = fmt.Sprintf("5555%s%s", message.Message, encoded)
-	//a.Log.Info("message = %s", messageString)
 
 	// formatted = 0001`	0f52f
 	// chopped = f52f
@@ -86,99 +81,177 @@ func (a *AirTouch) PrepareMessage(message *MessageInput) error {
 	return nil
 }
 
+// checksum returns the CRC16/MODBUS checksum the console uses to protect each frame.
+func checksum(data []byte) uint16 {
+	return crc16.Checksum(&crc16.Conf{
+		Poly: 0x8005, BitRev: true,
+		IniVal: 0xffff, FinVal: 0x0,
+		BigEnd: false,
+	}, data)
+}
+
 // SendMessage connects to the Airtouch 4 console and sends a message to retrieve
 // AC or group info.
 func (a *AirTouch) SendMessage(message *string) ([]byte, error) {
 	hostname := net.ParseIP(a.IPAddress)
 	port := a.Port
 	bufferSize := 1024
+	address := fmt.Sprintf("%s:%d", hostname, port)
+
+	messageToSend, err := hex.DecodeString(*message)
+	if err != nil {
+		return nil, &ValidationError{Field: "message", Value: *message, Reason: err.Error()}
+	}
 
 	// Create TCP address.
-	tcpAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", hostname, port))
+	tcpAddr, err := net.ResolveTCPAddr("tcp", address)
 	if err != nil {
-		return nil, fmt.Errorf("tcpAddr: %s", err)
+		return nil, &ConnectionError{Op: "resolve", Address: address, Err: err}
 	}
 
 	// Make connection.
 	conn, err := net.DialTCP("tcp", nil, tcpAddr)
 	if err != nil {
-		return nil, fmt.Errorf("dialtimeout: %s", err)
+		return nil, &ConnectionError{Op: "dial", Address: address, Err: err}
 	}
+	defer conn.Close()
 
 	// Set timeout.
-	conn.SetDeadline(time.Now().Add(5 * time.Second))
-
-	messageToSend := make([]byte, hex.DecodedLen(len([]byte(*message))))
-	hex.Decode(messageToSend, []byte(*message))
+	err = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err != nil {
+		return nil, &ConnectionError{Op: "set deadline", Address: address, Err: err}
+	}
 
 	// Send message.
-	//a.Log.Debug("messageString: %s", *message)
-	//a.Log.Debug("messageToSend: %v", messageToSend)
+	a.traceFrame("sent", messageToSend)
 
 	_, err = conn.Write(messageToSend)
 	if err != nil {
-		return nil, fmt.Errorf("connwrite: %s", err)
+		return nil, &ConnectionError{Op: "write", Address: address, Err: err}
 	}
 
-	//a.Log.Debug("wrote: %d", written)
-
 	reply := make([]byte, bufferSize)
-	_, err = conn.Read(reply)
+	read, err := conn.Read(reply)
 	if err != nil {
-		return nil, fmt.Errorf("reading reply: %s", err)
+		return nil, &ConnectionError{Op: "read", Address: address, Err: err}
 	}
 
-	//a.Log.Debug("read: %d", read)
-	//a.Log.Debug("reply: %v", reply)
+	a.traceFrame("received", reply[:read])
 
-	return reply, nil
+	return reply[:read], nil
 }
 
-// TranslatePacketToMessage decodes the server reply.
+// TranslatePacketToMessage decodes the server reply. The body is bounded by the length in the
+// header and the CRC that follows it is checked.
 func (a *AirTouch) TranslatePacketToMessage(dataResult []byte) (MessageOutput, error) {
-	//a.Log.Debug("starting with: %v", dataResult)
+	if len(dataResult) < 8 {
+		return MessageOutput{}, &FrameError{Reason: fmt.Sprintf("reply too short: %d bytes", len(dataResult)), Frame: dataResult}
+	}
+
+	if dataResult[0] != 0x55 || dataResult[1] != 0x55 {
+		return MessageOutput{}, &FrameError{Reason: fmt.Sprintf("unexpected header %x", dataResult[0:2]), Frame: dataResult}
+	}
+
+	dataLength := int(binary.BigEndian.Uint16(dataResult[6:8]))
+	if len(dataResult) < 8+dataLength+2 {
+		return MessageOutput{}, &FrameError{Reason: fmt.Sprintf("reply truncated: header declares %d data bytes, got %d", dataLength, len(dataResult)-10), Frame: dataResult}
+	}
+
+	expected := binary.BigEndian.Uint16(dataResult[8+dataLength : 8+dataLength+2])
+	actual := checksum(dataResult[2 : 8+dataLength])
+	if expected != actual {
+		return MessageOutput{}, &CRCError{Expected: expected, Actual: actual}
+	}
 
 	response := MessageOutput{
 		Address: dataResult[2:4],
 		ID:      dataResult[4:5],
 		Type:    dataResult[5:6],
 		Length:  dataResult[6:8],
-		Body:    dataResult[8:],
+		Body:    dataResult[8 : 8+dataLength],
 	}
 
-	//a.Log.Debug("address: %v", response.Address)
-	//a.Log.Debug("messageId: %v", response.Id)
-	//a.Log.Debug("messageType: %x", response.Type)
-	//a.Log.Debug("dataLength: %v", response.Length)
-	//a.Log.Debug("body: %v", response.Body)
-
 	return response, nil
 }
 
 // DecodeGroupNameMessage decodes the group name which is not returned with the status request.
+// The names are cached so that later status replies and ResolveGroup can use them.
 func (a *AirTouch) DecodeGroupNameMessage(response MessageOutput) error {
-	//a.Log.Debug("groupname: %v", response.Body)
+	if len(response.Body) < 2 {
+		return &DecodeError{Message: "GroupName", Err: fmt.Errorf("body too short: %d bytes", len(response.Body))}
+	}
 
-	for i, chunk := range chunk(response.Body[2:], 9) {
-		if i > 3 {
-			break
+	names := make(map[int]string)
+
+	for _, chunk := range chunk(response.Body[2:], 9) {
+		if len(chunk) < 9 {
+			return &DecodeError{Message: "GroupName", Err: fmt.Errorf("chunk too short: %d bytes", len(chunk))}
 		}
 
-		groupNumber := chunk[0]
+		groupNumber := int(chunk[0])
 		groupName := chunk[1:9]
-		//a.Log.Debug("groupNumber: %d", groupNumber)
-		//a.Log.Debug("groupName: %s", groupName)
+
 		// Remove any NULL characters
-		a.Groups[groupNumber].Name = string(bytes.Trim(groupName, "\x00"))
+		names[groupNumber] = string(bytes.Trim(groupName, "\x00"))
+		a.trace("decoded group name", "number", groupNumber, "name", names[groupNumber], "raw", hex.EncodeToString(groupName))
+	}
+
+	a.groupNames = names
+
+	for i := range a.Groups {
+		a.Groups[i].Name = a.groupNames[a.Groups[i].Number]
 	}
 
 	return nil
 }
 
+// DecodeACAbilityMessage decodes the modes and setpoint ranges the AC supports along with the
+// groups it serves. Only the first AC is decoded.
+func (a *AirTouch) DecodeACAbilityMessage(response MessageOutput) error {
+	if len(response.Body) < 28 {
+		return &DecodeError{Message: "ACAbility", Err: fmt.Errorf("body too short: %d bytes", len(response.Body))}
+	}
+
+	body := response.Body
+	capabilities := Capabilities{
+		StartGroup:      int(body[4]),
+		GroupCount:      int(body[5]),
+		MinCoolSetpoint: int(body[24]),
+		MaxCoolSetpoint: int(body[25]),
+		MinHeatSetpoint: int(body[26]),
+		MaxHeatSetpoint: int(body[27]),
+	}
+
+	// Bits 5-1 flag cool, fan, dry, heat and auto support.
+	modes := []struct {
+		bit   byte
+		modes []string
+	}{
+		{0x10, []string{"Cool"}},
+		{0x08, []string{"Fan"}},
+		{0x04, []string{"Dry"}},
+		{0x02, []string{"Heat"}},
+		{0x01, []string{"Auto", "AutoHeat", "AutoCool"}},
+	}
+
+	for _, mode := range modes {
+		if body[22]&mode.bit != 0 {
+			capabilities.Modes = append(capabilities.Modes, mode.modes...)
+		}
+	}
+
+	a.Capabilities = &capabilities
+
+	a.logger().Debug("decoded AC ability", "capabilities", capabilities)
+
+	return nil
+}
+
 // DecodeACStatusMessage decodes the AC status. An AC has many groups. The AC itself
 // has many attributes.
 func (a *AirTouch) DecodeACStatusMessage(response MessageOutput) error {
 	packetInfoLocationMap := a.ACStatusMap()
+	oldAC := a.AC
 
 	for i, chunk := range chunk(response.Body, 8) {
 		if i > 0 {
@@ -186,28 +259,38 @@ func (a *AirTouch) DecodeACStatusMessage(response MessageOutput) error {
 		}
 
 		for k := range packetInfoLocationMap {
-
 			mapValue, err := a.TranslateMapValueToValue(chunk, packetInfoLocationMap[k])
 			if err != nil {
-				return err
+				return &DecodeError{Message: "ACStatus", Field: k, Err: err}
 			}
 
-			// a.Log.Debug("key: %s", k)
-			// a.Log.Debug("value: %s", *mapValue)
+			a.trace("decoded field", "message", "ACStatus", "field", k, "location", packetInfoLocationMap[k], "value", *mapValue)
 
 			if k == "Temperature" {
 				a.AC.Temperature = (float64(*mapValue) - 500) / 10
+			} else if k == "PowerState" {
+				if int(*mapValue) == 0 {
+					a.AC.PowerState = "Off"
+				} else if int(*mapValue) == 1 {
+					a.AC.PowerState = "On"
+				} else {
+					a.AC.PowerState = strconv.Itoa(int(*mapValue))
+				}
 			} else if k == "AcTargetSetpoint" {
 				a.AC.AcTargetSetpoint = int(*mapValue)
 			} else if k == "AcMode" {
-				if int(*mapValue) == 3 {
-					a.AC.AcMode = "Fan"
-				} else if int(*mapValue) == 4 {
-					a.AC.AcMode = "Cool"
-				} else if int(*mapValue) == 1 {
-					a.AC.AcMode = "Heat"
-				} else { // TODO: Map the rest of the modes.
-					a.AC.AcMode = strconv.Itoa(int(*mapValue))
+				a.AC.AcMode = strconv.Itoa(int(*mapValue))
+				for mode, value := range a.ACModeMap() {
+					if value == a.AC.AcMode {
+						a.AC.AcMode = mode
+					}
+				}
+			} else if k == "AcFanSpeed" {
+				a.AC.AcFanSpeed = strconv.Itoa(int(*mapValue))
+				for speed, value := range a.ACFanSpeedMap() {
+					if value == a.AC.AcFanSpeed {
+						a.AC.AcFanSpeed = speed
+					}
 				}
 			} else if k == "Spill" {
 				if int(*mapValue) == 0 {
@@ -219,6 +302,14 @@ func (a *AirTouch) DecodeACStatusMessage(response MessageOutput) error {
 		}
 	}
 
+	a.logger().Debug("decoded AC status", "ac", a.AC)
+
+	a.recordCompressor(oldAC, a.AC)
+
+	events := diffAC(oldAC, a.AC, a.clock())
+	a.detectManualACChanges(oldAC, events)
+	a.publish(events)
+
 	return nil
 }
 
@@ -245,8 +336,7 @@ func (a *AirTouch) FixOpenPercentages() {
 		}
 	}
 
-	log.Printf("Total open percentage = %d", totalOpen)
-	log.Printf("Total spill groups = %d", totalSpillGroups)
+	a.logger().Debug("fixing open percentages", "total_open", totalOpen, "total_spill_groups", totalSpillGroups)
 
 	// Now fix up the OpenPercentage for the spill groups.
 	for i := range a.Groups {
@@ -260,43 +350,34 @@ func (a *AirTouch) FixOpenPercentages() {
 // DecodeGroupStatusMessage decodes each zones status. Each zone has many attibutes which are
 // extracted and typed accordingly.
 func (a *AirTouch) DecodeGroupStatusMessage(response MessageOutput) error {
-	//a.Log.Debug("groupstatus: %v", response.Body)
 	packetInfoLocationMap := a.GroupStatusMap()
 
 	var tempGroups []Group
 
 	for i, chunk := range chunk(response.Body, 6) {
-		// TODO: Unhardcode 4 as it implies we should only consider 4 chunks (zones).
-		// Or make it configurable?
-		if i > 3 {
-			break
+		if len(chunk) < 6 {
+			return &DecodeError{Message: "GroupStatus", Err: fmt.Errorf("chunk %d too short: %d bytes", i, len(chunk))}
 		}
 
 		// groupNumber, err := a.TranslateMapValueToValue(chunk, packetInfoLocationMap["GroupNumber"])
 		// if err != nil {
 		// 	return nil, err
 		// }
-		//a.Log.Debug("--------------------------------")
-		//a.Log.Debug("groupNumber: %d", *groupNumber)
 
 		var group Group
 
 		for k := range packetInfoLocationMap {
-
 			mapValue, err := a.TranslateMapValueToValue(chunk, packetInfoLocationMap[k])
 			if err != nil {
-				return err
+				return &DecodeError{Message: "GroupStatus", Field: k, Err: err}
 			}
 
-			//a.Log.Debug("key: %s", k)
-			//a.Log.Debug("value: %s", *mapValue)
+			a.trace("decoded field", "message", "GroupStatus", "chunk", i, "field", k, "location", packetInfoLocationMap[k], "value", *mapValue)
 
 			//var value float64
 
 			if k == "Temperature" {
-				//a.Log.Debug("value: %d", *mapValue)
 				group.Temperature = (float64(*mapValue) - 500) / 10
-				//a.Log.Debug("%s: %.1f", k, group.Temperature)
 			} else if k == "GroupNumber" {
 				group.Number = int(*mapValue)
 			} else if k == "PowerState" {
@@ -323,80 +404,103 @@ func (a *AirTouch) DecodeGroupStatusMessage(response MessageOutput) error {
 				} else {
 					group.Spill = true
 				}
+			} else if k == "BatteryLow" {
+				group.BatteryLow = int(*mapValue) != 0
+			} else if k == "TurboSupport" {
+				group.TurboSupport = int(*mapValue) != 0
+			} else if k == "Sensor" {
+				group.Sensor = int(*mapValue) != 0
 			}
 		}
+
+		// Names only come with the group name reply, so use any we already know.
+		group.Name = a.groupNames[group.Number]
+
 		tempGroups = append(tempGroups, group)
 	}
 
+	oldGroups := a.Groups
 	a.Groups = tempGroups
 
+	events := diffGroups(oldGroups, a.Groups, a.clock())
+	a.detectManualGroupChanges(oldGroups, events)
+	a.publish(events)
+
 	return nil
 }
 
-// AddMapValueToBinaryValue adds map value to binary value.
-func (a *AirTouch) AddMapValueToBinaryValue(binaryMessagePayloadString string, attribute string, value string) (*string, error) {
-	//a.Log.Debug("Location map = %s", attribute)
-	//a.Log.Debug("Value to set = %s", value)
-
-	length := 8
+// parseLocation splits a "byte:lower-upper" packet location into its parts. Bits are numbered
+// from 1 and may span into the following byte when upper is greater than 8.
+func parseLocation(location string) (int, int, int, error) {
+	byteValue, bitValue, found := strings.Cut(location, ":")
+	if !found {
+		return 0, 0, 0, fmt.Errorf("invalid location %q", location)
+	}
 
-	firstValue := strings.Split(attribute, ":")[0]
-	//a.Log.Debug("firstValue: %s", firstValue)
+	lowerString, upperString, found := strings.Cut(bitValue, "-")
+	if !found {
+		return 0, 0, 0, fmt.Errorf("invalid location %q", location)
+	}
 
-	secondValue := strings.Split(attribute, ":")[1]
-	//a.Log.Debug("secondValue: %s", secondValue)
+	byteNumber, err := strconv.Atoi(byteValue)
+	if err != nil {
+		return 0, 0, 0, err
+	}
 
-	lowerValue, err := strconv.Atoi(strings.Split(secondValue, "-")[0])
+	lowerValue, err := strconv.Atoi(lowerString)
 	if err != nil {
-		return nil, err
+		return 0, 0, 0, err
 	}
-	//a.Log.Debug("lowerValue: %d", lowerValue)
 
-	upperValue, err := strconv.Atoi(strings.Split(secondValue, "-")[1])
+	upperValue, err := strconv.Atoi(upperString)
 	if err != nil {
-		return nil, err
+		return 0, 0, 0, err
 	}
-	//a.Log.Debug("upperValue: %d", upperValue)
 
-	// Spec counts bytes backwards so so do we.
-	bitmaskStart := length - (upperValue - 1)
-	//a.Log.Debug("bitmaskStart: %d", bitmaskStart)
+	if byteNumber < 1 || lowerValue < 1 || upperValue < lowerValue || upperValue > 16 {
+		return 0, 0, 0, fmt.Errorf("invalid location %q", location)
+	}
 
-	bitmaskEnd := length - (lowerValue - 1)
-	//a.Log.Debug("bitmaskEnd: %d", bitmaskEnd)
+	return byteNumber, lowerValue, upperValue, nil
+}
 
-	// binaryMessage needs to be at least as long as (byteNumber - 1) * 8 + bitmaskstart, so add as many zeroes as required to make that happen
+// AddMapValueToBinaryValue adds map value to binary value.
+func (a *AirTouch) AddMapValueToBinaryValue(binaryMessagePayloadString string, attribute string, value string) (*string, error) {
+	length := 8
 
-	firstValueAsInt, err := strconv.Atoi(firstValue)
+	firstValueAsInt, lowerValue, upperValue, err := parseLocation(attribute)
 	if err != nil {
 		return nil, err
 	}
-	//a.Log.Debug("firstValueAsInt: %d", firstValueAsInt)
 
-	// while(len(binaryMessagePayloadString) < (byteNumber - 1) * 8 + (bitmaskstart - 1)):
-	// binaryMessagePayloadString += "0"
+	if upperValue > length {
+		return nil, fmt.Errorf("location %q spans more than one byte", attribute)
+	}
 
-	//a.Log.Debug("len(binaryMessagePayloadString): %d", len(binaryMessagePayloadString))
+	// Spec counts bytes backwards so so do we.
+	bitmaskStart := length - (upperValue - 1)
+	bitmaskEnd := length - (lowerValue - 1)
 
+	// binaryMessage needs to be at least as long as (byteNumber - 1) * 8 + bitmaskstart, so add as many zeroes as required to make that happen
 	for len(binaryMessagePayloadString) < (firstValueAsInt-1)*8+(bitmaskStart-1) {
 		binaryMessagePayloadString += "0"
 	}
-	//a.Log.Debug("binaryMessagePayloadStringLoop: %s", binaryMessagePayloadString)
 
 	//binOfValueAsString = bin(value)[2:];
 	valueAsInt, err := strconv.Atoi(value)
 	if err != nil {
-		return nil, err
+		return nil, &ValidationError{Field: attribute, Value: value, Reason: "not a number"}
 	}
 
-	binOfValueAsString := strconv.FormatInt(int64(valueAsInt), 2)[0:]
-	//a.Log.Debug("binOfValueAsString: %s", binOfValueAsString)
-
 	lengthNeededForBinValue := bitmaskEnd - (bitmaskStart - 1)
-	//a.Log.Debug("lengthNeededForBinValue: %d", lengthNeededForBinValue)
+
+	if valueAsInt < 0 || valueAsInt >= 1<<lengthNeededForBinValue {
+		return nil, &ValidationError{Field: attribute, Value: value, Reason: fmt.Sprintf("does not fit in %d bits", lengthNeededForBinValue)}
+	}
+
+	binOfValueAsString := strconv.FormatInt(int64(valueAsInt), 2)
 
 	binaryMessagePayloadString = binaryMessagePayloadString + "00000000"[0:lengthNeededForBinValue-len(binOfValueAsString)] + binOfValueAsString
-	//a.Log.Debug("binaryMessagePayloadString: %s", binaryMessagePayloadString)
 
 	return &binaryMessagePayloadString, nil
 }
@@ -404,78 +508,40 @@ func (a *AirTouch) AddMapValueToBinaryValue(binaryMessagePayloadString string, a
 // TranslateMapValueToValue takes a chunk and the position where we expect values to be located
 // and translates this to an actual value.
 func (a *AirTouch) TranslateMapValueToValue(chunk []byte, packetInfoLocation string) (*int64, error) {
-	//a.Log.Debug("locationMap: %s", packetInfoLocation)
-	//a.Log.Debug("chunk: %v", chunk)
 	length := 8
 
-	firstValue := strings.Split(packetInfoLocation, ":")[0]
-	//a.Log.Debug("firstValue: %s", firstValue)
-
-	secondValue := strings.Split(packetInfoLocation, ":")[1]
-	//a.Log.Debug("secondValue: %s", secondValue)
-
-	byteNumber, err := strconv.Atoi(firstValue)
+	byteNumber, lowerValue, upperValue, err := parseLocation(packetInfoLocation)
 	if err != nil {
 		return nil, err
 	}
-	//a.Log.Debug("byteNumber: %d", byteNumber)
-
-	lowerValue, err := strconv.Atoi(strings.Split(secondValue, "-")[0])
-	if err != nil {
-		return nil, err
-	}
-	//a.Log.Debug("lowerValue: %d", lowerValue)
-
-	upperValue, err := strconv.Atoi(strings.Split(secondValue, "-")[1])
-	if err != nil {
-		return nil, err
-	}
-	//a.Log.Debug("upperValue: %d", upperValue)
 
 	if upperValue > 8 {
 		length = 16
-		//a.Log.Debug("upperValue > 8 so length changed to 16")
+	}
+
+	if len(chunk) < byteNumber-1+length/8 {
+		return nil, fmt.Errorf("location %q is beyond the %d byte chunk", packetInfoLocation, len(chunk))
 	}
 
 	// Spec counts bytes backwards so so do we.
 	bitmaskStart := length - (upperValue - 1)
-	//a.Log.Debug("bitmaskStart: %d", bitmaskStart)
 	bitmaskEnd := length - (lowerValue - 1)
-	//a.Log.Debug("bitmaskEnd: %d", bitmaskEnd)
-
-	//a.Log.Debug("raw: %v", chunk[byteNumber-1])
-	//a.Log.Debug("hex: %s", fmt.Sprintf("%x", chunk[byteNumber-1]))
-	byteToInt, err := strconv.Atoi(fmt.Sprintf("%v", chunk[byteNumber-1]))
-	if err != nil {
-		return nil, err
-	}
-	//a.Log.Debug("byteToInt: %d", byteToInt)
 
 	// Convert to binary.
-	byteAsString := strconv.FormatInt(int64(byteToInt), 2)
-	//a.Log.Debug("byteAsString: %s", byteAsString)
-	byteStringAdjusted := "00000000"[0:8-len(byteAsString)] + byteAsString[0:]
-	//a.Log.Debug("byteStringAdjusted: %s", byteStringAdjusted)
+	byteAsString := strconv.FormatInt(int64(chunk[byteNumber-1]), 2)
+	byteStringAdjusted := "00000000"[0:8-len(byteAsString)] + byteAsString
 
 	if length > 8 {
-
 		byteNumberToBinary := strconv.FormatInt(int64(chunk[byteNumber]), 2)
-		//a.Log.Debug("byteNumberToBinary: %s", byteNumberToBinary)
-		//a.Log.Debug("firstPart: %d", 8-(len(byteNumberToBinary)))
-		//a.Log.Debug("secondPart: %d", byteNumberToBinary)
-
 		byteStringAdjusted += ("00000000"[0:8-(len(byteNumberToBinary))] + byteNumberToBinary)
-		//a.Log.Debug("length > 8 so byteStringAdjusted: %s", byteStringAdjusted)
 	}
 
 	byteSegment := byteStringAdjusted[bitmaskStart-1 : bitmaskEnd]
-	//a.Log.Debug("byteSegment: %s", byteSegment)
 
 	byteSegmentAsValue, err := strconv.ParseInt(byteSegment, 2, 64)
 	if err != nil {
 		return nil, err
 	}
-	//a.Log.Debug("byteSegmentAsValue: %d", byteSegmentAsValue)
 
 	return &byteSegmentAsValue, nil
 }
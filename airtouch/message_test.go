@@ -0,0 +1,232 @@
+package airtouch
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// goldenReply is a set of console replies in testdata/golden along with the groups and AC they
+// are expected to decode to. Source says whether the frames were captured from a console or are
+// synthetic.
+type goldenReply struct {
+	Description string
+	Source      string
+	GroupStatus string `json:"group_status"`
+	GroupName   string `json:"group_name"`
+	ACStatus    string `json:"ac_status"`
+	Groups      []Group
+	AC          *AC
+}
+
+// decodeGoldenFrame hex decodes a golden frame and translates it into a message.
+func decodeGoldenFrame(t *testing.T, a *AirTouch, frame string) MessageOutput {
+	t.Helper()
+
+	data, err := hex.DecodeString(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := a.TranslatePacketToMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return response
+}
+
+func TestGoldenReplies(t *testing.T) {
+	files, err := filepath.Glob("testdata/golden/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) == 0 {
+		t.Fatal("no golden replies found")
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var golden goldenReply
+			if err := json.Unmarshal(content, &golden); err != nil {
+				t.Fatal(err)
+			}
+
+			if golden.Source != "captured" && golden.Source != "synthetic" {
+				t.Fatalf("source must be captured or synthetic, got %q", golden.Source)
+			}
+
+			a := AirTouch{}
+
+			if golden.GroupStatus != "" {
+				if err := a.DecodeGroupStatusMessage(decodeGoldenFrame(t, &a, golden.GroupStatus)); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := a.DecodeGroupNameMessage(decodeGoldenFrame(t, &a, golden.GroupName)); err != nil {
+					t.Fatal(err)
+				}
+
+				a.FixOpenPercentages()
+
+				if !reflect.DeepEqual(a.Groups, golden.Groups) {
+					t.Errorf("groups:\nexpected %+v\ngot      %+v", golden.Groups, a.Groups)
+				}
+			}
+
+			if golden.ACStatus != "" {
+				if err := a.DecodeACStatusMessage(decodeGoldenFrame(t, &a, golden.ACStatus)); err != nil {
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual(a.AC, *golden.AC) {
+					t.Errorf("ac:\nexpected %+v\ngot      %+v", *golden.AC, a.AC)
+				}
+			}
+		})
+	}
+}
+
+// replyFrame builds a console reply frame around data, including a valid CRC.
+func replyFrame(messageType byte, data []byte) []byte {
+	frame := []byte{0x55, 0x55, 0xb0, 0x80, 0x01, messageType, 0x00, 0x00}
+	binary.BigEndian.PutUint16(frame[6:8], uint16(len(data)))
+	frame = append(frame, data...)
+
+	return binary.BigEndian.AppendUint16(frame, checksum(frame[2:]))
+}
+
+var groupStatusSeed = []byte{
+	0x40, 0x64, 0x16, 0x80, 0x6a, 0x60,
+	0x41, 0x32, 0x17, 0x80, 0x6c, 0x60,
+	0x02, 0x00, 0x15, 0x00, 0x68, 0x00,
+	0x43, 0x5f, 0x16, 0x80, 0x6b, 0x68,
+}
+
+var groupNameSeed = []byte{
+	0xff, 0x12,
+	0x00, 'L', 'i', 'v', 'i', 'n', 'g', 0x00, 0x00,
+	0x01, 'B', 'e', 'd', 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+var acStatusSeed = []byte{0x40, 0x41, 0x16, 0x00, 0x00, 0x6a, 0x60, 0x00}
+
+func FuzzTranslatePacketToMessage(f *testing.F) {
+	f.Add(replyFrame(0x2b, groupStatusSeed))
+	f.Add(replyFrame(0x1f, groupNameSeed))
+	f.Add(replyFrame(0x2d, acStatusSeed))
+	f.Add([]byte{0x55, 0x55})
+	f.Add([]byte{0x55, 0x55, 0xb0, 0x80, 0x01, 0x2b, 0xff, 0xff})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		a := AirTouch{}
+		response, err := a.TranslatePacketToMessage(data)
+		if err != nil {
+			return
+		}
+
+		if len(response.Body) != int(binary.BigEndian.Uint16(response.Length)) {
+			t.Errorf("body is %d bytes, header declares %d", len(response.Body), binary.BigEndian.Uint16(response.Length))
+		}
+	})
+}
+
+func FuzzDecodeGroupStatusMessage(f *testing.F) {
+	f.Add(groupStatusSeed)
+	f.Add(groupStatusSeed[:6])
+	f.Add(groupStatusSeed[:5])
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		a := AirTouch{}
+		err := a.DecodeGroupStatusMessage(MessageOutput{Body: body})
+		if err != nil {
+			return
+		}
+
+		if len(a.Groups) != len(body)/6 {
+			t.Errorf("decoded %d groups from %d bytes", len(a.Groups), len(body))
+		}
+
+		a.FixOpenPercentages()
+	})
+}
+
+func FuzzDecodeGroupNameMessage(f *testing.F) {
+	f.Add(groupNameSeed)
+	f.Add(groupNameSeed[:5])
+	f.Add([]byte{0xff})
+	f.Add([]byte{0xff, 0x12, 0xfe, 'X', 0, 0, 0, 0, 0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		a := AirTouch{Groups: []Group{{Number: 0}, {Number: 1}, {Number: 2}, {Number: 3}}}
+		_ = a.DecodeGroupNameMessage(MessageOutput{Body: body})
+
+		if len(a.Groups) != 4 {
+			t.Errorf("decoding names changed the number of groups to %d", len(a.Groups))
+		}
+	})
+}
+
+func FuzzDecodeACStatusMessage(f *testing.F) {
+	f.Add(acStatusSeed)
+	f.Add(acStatusSeed[:5])
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		a := AirTouch{}
+		_ = a.DecodeACStatusMessage(MessageOutput{Body: body})
+	})
+}
+
+func FuzzTranslateMapValueToValue(f *testing.F) {
+	f.Add([]byte{0x40, 0x64, 0x16, 0x80, 0x6a, 0x60}, "5:6-16")
+	f.Add([]byte{0x40}, "1:7-8")
+	f.Add([]byte{0x40}, "2:1-8")
+	f.Add([]byte{0x40}, "1:8-1")
+	f.Add([]byte{0x40}, "1-8")
+	f.Add([]byte{0x40}, ":")
+
+	f.Fuzz(func(t *testing.T, chunk []byte, location string) {
+		a := AirTouch{}
+		value, err := a.TranslateMapValueToValue(chunk, location)
+		if err != nil {
+			return
+		}
+
+		_, lowerValue, upperValue, _ := parseLocation(location)
+		if *value < 0 || *value >= 1<<(upperValue-lowerValue+1) {
+			t.Errorf("value %d does not fit in location %q", *value, location)
+		}
+	})
+}
+
+func FuzzReply(f *testing.F) {
+	f.Add(replyFrame(0x2b, groupStatusSeed), replyFrame(0x1f, groupNameSeed), replyFrame(0x2d, acStatusSeed))
+
+	f.Fuzz(func(t *testing.T, statusFrame []byte, nameFrame []byte, acFrame []byte) {
+		a := AirTouch{}
+
+		if response, err := a.TranslatePacketToMessage(statusFrame); err == nil {
+			_ = a.DecodeGroupStatusMessage(response)
+		}
+
+		if response, err := a.TranslatePacketToMessage(nameFrame); err == nil {
+			_ = a.DecodeGroupNameMessage(response)
+		}
+
+		if response, err := a.TranslatePacketToMessage(acFrame); err == nil {
+			_ = a.DecodeACStatusMessage(response)
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package airtouch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OverrideRule lets a household opt out of RunACModeSwitchingPatch. A rule is active when a group
+// matches every field that is set, within the time window and before the expiry.
+type OverrideRule struct {
+	// Reason describes the rule in the logs and in ActiveOverride.
+	Reason string `json:"reason"`
+	// Group is a group number, name or alias. Empty matches any group.
+	Group string `json:"group"`
+	// Power is one of the GroupPowerMap powers.
+	Power string `json:"power"`
+	// ControlMethod is one of the GroupControlMethodMap methods.
+	ControlMethod string `json:"control_method"`
+	// OpenPercentage is the exact percentage the group must be open.
+	OpenPercentage string `json:"open_percentage"`
+	// Start and End are a daily time window as 15:04 in Timezone. The window may wrap midnight.
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Expires stops the rule matching from this time. Zero never expires.
+	Expires time.Time `json:"expires"`
+}
+
+// Override is an override rule that matched a group.
+type Override struct {
+	Rule   OverrideRule
+	Group  Group
+	Reason string
+}
+
+// ActiveOverride returns the first override rule in the patch config that matches a group, or
+// nil if none do.
+func (a *AirTouch) ActiveOverride() *Override {
+	now := a.clock()
+
+	loc, err := time.LoadLocation(a.Timezone)
+	if err != nil {
+		a.logger().Warn("unable to load timezone, ignoring override time windows", "timezone", a.Timezone, "error", err)
+		loc = time.UTC
+	}
+
+	for _, rule := range a.CurrentPatchConfig().Overrides {
+		if !rule.Expires.IsZero() && !now.Before(rule.Expires) {
+			continue
+		}
+
+		if !rule.inWindow(now.In(loc)) {
+			continue
+		}
+
+		for _, g := range a.Groups {
+			if a.overrideMatches(rule, g) {
+				return &Override{Rule: rule, Group: g, Reason: rule.describe(g)}
+			}
+		}
+	}
+
+	return nil
+}
+
+// EscapeProgramming returns true if an override rule is active.
+func (a *AirTouch) EscapeProgramming() bool {
+	override := a.ActiveOverride()
+	if override == nil {
+		return false
+	}
+
+	a.logger().Info("override active, skipping programming", "reason", override.Reason)
+
+	return true
+}
+
+// overrideMatches compares a group against the fields a rule sets.
+func (a *AirTouch) overrideMatches(rule OverrideRule, g Group) bool {
+	if rule.Group != "" && !a.groupMatches(rule.Group, g) {
+		return false
+	}
+
+	if rule.Power != "" && g.PowerState != rule.Power {
+		return false
+	}
+
+	if rule.ControlMethod != "" && g.ControlMethod != rule.ControlMethod {
+		return false
+	}
+
+	if rule.OpenPercentage != "" && strconv.Itoa(g.OpenPercentage) != rule.OpenPercentage {
+		return false
+	}
+
+	return true
+}
+
+// groupMatches returns true if a group number, name or alias refers to g. Unlike ResolveGroup it
+// never queries the console, and aliases that differ only in case match nothing.
+func (a *AirTouch) groupMatches(group string, g Group) bool {
+	group, err := a.resolveAlias(group)
+	if err != nil {
+		return false
+	}
+
+	if number, err := strconv.Atoi(group); err == nil {
+		return number == g.Number
+	}
+
+	return strings.EqualFold(group, g.Name)
+}
+
+// inWindow returns true if the local time is within the rule's daily window, or it has none.
+func (r OverrideRule) inWindow(local time.Time) bool {
+	if r.Start == "" && r.End == "" {
+		return true
+	}
+
+	start, _ := time.Parse("15:04", r.Start)
+	end, _ := time.Parse("15:04", r.End)
+
+	minute := local.Hour()*60 + local.Minute()
+	startMinute := start.Hour()*60 + start.Minute()
+	endMinute := end.Hour()*60 + end.Minute()
+
+	if startMinute <= endMinute {
+		return minute >= startMinute && minute < endMinute
+	}
+
+	return minute >= startMinute || minute < endMinute
+}
+
+// describe explains why a rule matched a group.
+func (r OverrideRule) describe(g Group) string {
+	reason := r.Reason
+	if reason == "" {
+		reason = "override"
+	}
+
+	description := fmt.Sprintf("%s: group %s is %s, %s at %d%%", reason, g.Name, g.PowerState, g.ControlMethod, g.OpenPercentage)
+
+	if r.Start != "" {
+		description += fmt.Sprintf(", between %s and %s", r.Start, r.End)
+	}
+
+	if !r.Expires.IsZero() {
+		description += ", until " + r.Expires.Format(time.RFC3339)
+	}
+
+	return description
+}
+
+// validateOverrideRule checks the values a rule compares against exist. A rule without any
+// conditions would always match and disable the patch for good.
+func (a *AirTouch) validateOverrideRule(rule OverrideRule) error {
+	if rule.Group == "" && rule.Power == "" && rule.ControlMethod == "" && rule.OpenPercentage == "" && rule.Start == "" {
+		return &ValidationError{Field: "Overrides", Value: rule.Reason, Reason: "rules must set a group, power, control method, open percentage or time window"}
+	}
+
+	if _, ok := a.GroupPowerMap()[rule.Power]; rule.Power != "" && !ok {
+		return &ValidationError{Field: "Power", Value: rule.Power, Reason: "unknown power state"}
+	}
+
+	if _, ok := a.GroupControlMethodMap()[rule.ControlMethod]; rule.ControlMethod != "" && !ok {
+		return &ValidationError{Field: "ControlMethod", Value: rule.ControlMethod, Reason: "unknown control method"}
+	}
+
+	if _, err := strconv.Atoi(rule.OpenPercentage); rule.OpenPercentage != "" && err != nil {
+		return &ValidationError{Field: "OpenPercentage", Value: rule.OpenPercentage, Reason: "not a number"}
+	}
+
+	if (rule.Start == "") != (rule.End == "") {
+		return &ValidationError{Field: "Start", Value: rule.Start, Reason: "start and end must be set together"}
+	}
+
+	if _, err := time.Parse("15:04", rule.Start); rule.Start != "" && err != nil {
+		return &ValidationError{Field: "Start", Value: rule.Start, Reason: "not a 15:04 time"}
+	}
+
+	if _, err := time.Parse("15:04", rule.End); rule.End != "" && err != nil {
+		return &ValidationError{Field: "End", Value: rule.End, Reason: "not a 15:04 time"}
+	}
+
+	return nil
+}
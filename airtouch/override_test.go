@@ -0,0 +1,111 @@
+package airtouch
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestActiveOverride(t *testing.T) {
+	now := time.Date(2024, 1, 1, 21, 30, 0, 0, time.UTC)
+	a := AirTouch{
+		Timezone:     "UTC",
+		GroupAliases: map[string]string{"baby": "Nursery"},
+		Groups: []Group{
+			{Name: "Living", Number: 0, PowerState: "On", ControlMethod: "TemperatureControl"},
+			{Name: "Nursery", Number: 1, PowerState: "On", ControlMethod: "PercentageControl", OpenPercentage: 95},
+		},
+		now: func() time.Time { return now },
+	}
+
+	nursery := OverrideRule{Reason: "baby asleep", Group: "baby", Power: "On", ControlMethod: "PercentageControl", OpenPercentage: "95"}
+
+	tests := []struct {
+		name   string
+		modify func(*OverrideRule)
+		active bool
+	}{
+		{"match", func(r *OverrideRule) {}, true},
+		{"by number", func(r *OverrideRule) { r.Group = "1" }, true},
+		{"other percentage", func(r *OverrideRule) { r.OpenPercentage = "90" }, false},
+		{"other group", func(r *OverrideRule) { r.Group = "Living" }, false},
+		{"in window", func(r *OverrideRule) { r.Start, r.End = "21:00", "22:00" }, true},
+		{"outside window", func(r *OverrideRule) { r.Start, r.End = "06:00", "21:00" }, false},
+		{"window wrapping midnight", func(r *OverrideRule) { r.Start, r.End = "19:00", "07:00" }, true},
+		{"expired", func(r *OverrideRule) { r.Expires = now }, false},
+		{"not expired", func(r *OverrideRule) { r.Expires = now.Add(time.Hour) }, true},
+	}
+
+	for _, test := range tests {
+		rule := nursery
+		test.modify(&rule)
+
+		config := DefaultPatchConfig()
+		config.Overrides = []OverrideRule{rule}
+		if err := a.SetPatchConfig(config); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		override := a.ActiveOverride()
+		if (override != nil) != test.active {
+			t.Errorf("%s: expected active %t, got %+v", test.name, test.active, override)
+			continue
+		}
+
+		if override != nil && (override.Group.Name != "Nursery" || !strings.HasPrefix(override.Reason, "baby asleep: group Nursery is On")) {
+			t.Errorf("%s: unexpected override %+v", test.name, override)
+		}
+	}
+}
+
+func TestOverrideRuleValidation(t *testing.T) {
+	a := AirTouch{}
+
+	for _, rule := range []OverrideRule{
+		{Power: "Sideways"},
+		{ControlMethod: "Vibes"},
+		{OpenPercentage: "most"},
+		{Start: "21:00"},
+		{Start: "9pm", End: "22:00"},
+		{Reason: "always"},
+	} {
+		config := DefaultPatchConfig()
+		config.Overrides = []OverrideRule{rule}
+
+		if err := a.SetPatchConfig(config); !errors.Is(err, ErrValidation) {
+			t.Errorf("%+v: expected ErrValidation, got %v", rule, err)
+		}
+	}
+}
+
+func TestPatchSkippedByOverride(t *testing.T) {
+	requests := 0
+	a := fakeConsole(t, func(request []byte) []byte {
+		requests++
+		return acStatusReply
+	})
+
+	a.RootTempDir = t.TempDir()
+	a.Confirmation = ConfirmNone
+	a.AC = AC{PowerState: "On", AcMode: "Fan"}
+	a.Groups = []Group{{Name: "Living", PowerState: "On", ControlMethod: "PercentageControl", OpenPercentage: 95, Temperature: 25, TargetSetpoint: 22}}
+
+	if err := a.WriteValueToFile("current_ac_mode", "Cool"); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultPatchConfig()
+	config.Overrides = []OverrideRule{{Group: "Living", OpenPercentage: "95"}}
+	if err := a.SetPatchConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.RunACModeSwitchingPatch(); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 0 {
+		t.Errorf("expected the override to keep Fan on, got %d requests", requests)
+	}
+}
@@ -2,47 +2,89 @@ package airtouch
 
 import (
 	"errors"
-	"log"
+	"strings"
+	"time"
 )
 
-type groupTemperature struct {
-	name             string
-	diffSetpointTemp float64
-	currentTemp      float64
-}
+// ModeSwitchingRuleName is the name of the built in mode switching rule.
+const ModeSwitchingRuleName = "ModeSwitching"
 
 // RunACModeSwitchingPatch Currently, when cooling, the spill will eventually become active after satisfying the currently selected
 // cooling algorithm e.g. average. For some reason, it takes a really long time for the AC the stop the compressor...
 // During this time, the spill group/room is freezing and copious amounts of power is used unnecessarily cooling.
 // 1) What this patch does is detect when the AC mode is cooling AND the spill is active.
 // 2) Switch the AC mode to Fresh.
-// 3) When SensorTemp - FreshSetpointTemp >= 1 AND (Nursery is On AND Mode == Percentage AND OpenPercentage == 95%), switch AC mode to Cooling
-// The additional conditional on 3) allows the user to opt-out of this patch if they genuinely want to run Fresh without
-// it switching back to cooling mode automatically.
+// 3) When SensorTemp - FreshSetpointTemp >= 1, switch AC mode to Cooling
+// The patch is skipped while a PatchConfig override rule is active. This allows the user to opt-out of this patch if
+// they genuinely want to run Fresh without it switching back to cooling mode automatically.
+//
+// The patch is the ModeSwitchingRule. RunACModeSwitchingPatch runs it once with its persisted rule state, unless
+// the rule has been disabled.
 func (a *AirTouch) RunACModeSwitchingPatch() error {
-	log.Printf("AC mode is currently = %s", a.AC.AcMode)
-	if !(a.AC.AcMode == "Cool" || a.AC.AcMode == "Heat" || a.AC.AcMode == "Fan") {
-		log.Printf("Unsupported AC mode %s, skipping running patch", a.AC.AcMode)
+	state := a.loadRuleState(ModeSwitchingRuleName)
+	if !state.Enabled {
+		a.logger().Info("mode switching rule disabled, skipping patch")
 		return nil
 	}
 
-	// Record the AC mode so that when we switch back to Fan, we know whether we are meant to be Heating or Cooling.
-	if a.AC.AcMode == "Cool" || a.AC.AcMode == "Heat" {
-		err := a.WriteValueToFile("current_ac_mode", a.AC.AcMode)
-		if err != nil {
-			log.Printf("Unable to write mode to file, please correct, skipping running patch")
-			return nil
-		}
+	err := a.runModeSwitching(state)
+
+	saveErr := a.saveRuleState(ModeSwitchingRuleName, state)
+	if saveErr != nil {
+		a.logger().Warn("unable to save mode switching rule state", "error", saveErr)
+	}
+
+	return err
+}
+
+// ModeSwitchingRule runs the mode switching patch every ReportLoopPeriod seconds, or every minute if that is not set.
+func (a *AirTouch) ModeSwitchingRule() Rule {
+	interval := time.Duration(a.ReportLoopPeriod) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	return Rule{
+		Name:    ModeSwitchingRuleName,
+		Trigger: Trigger{Type: TriggerSchedule, Interval: interval},
+		Actions: []Action{func(a *AirTouch, state *RuleState) error {
+			return a.runModeSwitching(state)
+		}},
+	}
+}
+
+// runModeSwitching is the body of the mode switching patch. The mode to go back to from the fallback mode is kept
+// in state.
+func (a *AirTouch) runModeSwitching(state *RuleState) error {
+	config := a.CurrentPatchConfig()
+	a.logger().Info("running AC mode switching patch", "mode", a.AC.AcMode, "config", config)
+
+	if !config.allowsMode(a.AC.AcMode) && a.AC.AcMode != config.FallbackMode {
+		a.logger().Info("unsupported AC mode, skipping patch", "mode", a.AC.AcMode)
+		return nil
+	}
+
+	if a.EscapeProgramming() {
+		return nil
+	}
+
+	if pause, ok := a.Paused(ScheduleTargetAC); ok {
+		a.logger().Info("AC changed manually, skipping patch", "until", pause.Until)
+		return nil
+	}
+
+	// Record the AC mode so that when we switch back from the fallback mode, we know whether we are meant to be
+	// Heating or Cooling.
+	if config.allowsMode(a.AC.AcMode) {
+		state.Set("current_ac_mode", a.AC.AcMode)
 	}
 
 	// Fan mode does not have a setpoint in the app. But we define one here so that we know at what point we need to
 	// switch the AC mode back to Cooling.
-	acBackToCoolingToleranceTemp := 0.3
-	acBackToHeatingToleranceTemp := -0.3
+	acBackToCoolingToleranceTemp := config.CoolingTolerance
+	acBackToHeatingToleranceTemp := config.HeatingTolerance
 	//acBackToFanSpillTolerancePct := 70
 
-	//a.Log.Debug("Fan tolerance temp from conf is = %f", acBackToCoolingToleranceTemp)
-
 	//groupSpill := false
 	//groupSpillOpenPercentage := -1
 
@@ -54,24 +96,22 @@ func (a *AirTouch) RunACModeSwitchingPatch() error {
 	// }
 
 	// Need to know whether we are heating or cooling as to whether we are finding the coldest or warmest room.
-	focusGroup, err := a.getTemperature()
+	focusGroup, err := a.getTemperature(config, state)
 	if err != nil {
-		log.Printf("Unable to determine if we're meant to be heating or cooling, try setting a mode?")
+		a.logger().Warn("unable to determine if we're meant to be heating or cooling, try setting a mode?", "error", err)
 		return nil
 	}
 
-	log.Printf("%s has the biggest temp difference %f", focusGroup.name, focusGroup.diffSetpointTemp)
-	log.Printf("Using this as the AC temp")
-	acTemperature := focusGroup.currentTemp
+	acTemperature := focusGroup.Temperature
 
-	lastACMode, err := a.ReadStringFromFile("current_ac_mode")
+	lastACMode, err := a.lastACMode(state)
 	if err != nil {
-		log.Printf("Unable to determine if we're meant to be heating or cooling, try setting a mode?")
+		a.logger().Warn("unable to determine if we're meant to be heating or cooling, try setting a mode?", "error", err)
 		return nil
 	}
 
 	// Wait until we are meaningfully spilling before switching back to Fan.
-	if a.AC.AcMode != "Fan" {
+	if a.AC.AcMode != config.FallbackMode {
 		// 	if lastACMode == "Cool" {
 
 		// 	}
@@ -85,68 +125,62 @@ func (a *AirTouch) RunACModeSwitchingPatch() error {
 		// 	}
 
 		if lastACMode == "Cool" {
-			log.Printf("Tolerance is %f", acBackToCoolingToleranceTemp)
+			a.logger().Debug("cooling tolerance", "tolerance", acBackToCoolingToleranceTemp)
 
 			// At temperature or cooler.
-			if focusGroup.diffSetpointTemp <= 0 {
-				log.Printf("Group temp diff %f is less than 0, so turning Fan mode on", focusGroup.diffSetpointTemp)
-				err := a.SetACState("On", "Fan")
+			if focusGroup.Diff <= 0 {
+				a.logger().Info("group temp diff is less than 0, turning fallback mode on", "diff", focusGroup.Diff, "mode", config.FallbackMode)
+				err := a.setPatchACMode(config.FallbackMode)
 				if err != nil {
 					return err
 				}
 			} else {
-				log.Printf("Group temp diff %f is greater than 0, so keeping Cool mode on", focusGroup.diffSetpointTemp)
-				//a.Log.Debug("Temp condition to turn AC back to Fan NOT satisfied")
+				a.logger().Debug("group temp diff is greater than 0, keeping Cool mode on", "diff", focusGroup.Diff)
 
 			}
 		} else if lastACMode == "Heat" {
-			log.Printf("Tolerance is %f", acBackToHeatingToleranceTemp)
+			a.logger().Debug("heating tolerance", "tolerance", acBackToHeatingToleranceTemp)
 
 			// At temperature or warmer.
-			if focusGroup.diffSetpointTemp >= 0 {
-				log.Printf("Group temp diff %f is greater than 0, so turning Fan mode on", focusGroup.diffSetpointTemp)
-				err := a.SetACState("On", "Fan")
+			if focusGroup.Diff >= 0 {
+				a.logger().Info("group temp diff is greater than 0, turning fallback mode on", "diff", focusGroup.Diff, "mode", config.FallbackMode)
+				err := a.setPatchACMode(config.FallbackMode)
 				if err != nil {
 					return err
 				}
 			} else {
-				log.Printf("Group temp diff %f is less than 0, so keeping Heat mode on", focusGroup.diffSetpointTemp)
-				//a.Log.Debug("Temp condition to turn AC back to Fan NOT satisfied")
+				a.logger().Debug("group temp diff is less than 0, keeping Heat mode on", "diff", focusGroup.Diff)
 			}
 		}
-	} else if a.AC.AcMode == "Fan" {
-		log.Printf("AC mode is Fan and Temp is %f", acTemperature)
-
+	} else if a.AC.AcMode == config.FallbackMode {
 		//currentTempDiff := acTemperature - float64(a.AC.AcTargetSetpoint)
-		log.Printf("Temp difference between group current and setpoint is = %f", focusGroup.diffSetpointTemp)
-
-		// a.Log.Debug("Total groups open is %d", groupsOn)
+		a.logger().Debug("AC mode is the fallback mode", "mode", a.AC.AcMode, "temperature", acTemperature, "diff", focusGroup.Diff)
 
 		if lastACMode == "Cool" {
-			log.Printf("Tolerance is %f", acBackToCoolingToleranceTemp)
+			a.logger().Debug("cooling tolerance", "tolerance", acBackToCoolingToleranceTemp)
 
-			if focusGroup.diffSetpointTemp >= acBackToCoolingToleranceTemp {
-				log.Printf("Temp condition to turn AC back to Cool satisfied")
+			if focusGroup.Diff >= acBackToCoolingToleranceTemp {
+				a.logger().Info("temp condition to turn AC back to Cool satisfied", "diff", focusGroup.Diff)
 
-				err := a.SetACState("On", "Cool")
+				err := a.setPatchACMode("Cool")
 				if err != nil {
 					return err
 				}
 			} else {
-				log.Printf("Group temp diff %f is less than tolerance %f, so keeping Fan mode on", focusGroup.diffSetpointTemp, acBackToCoolingToleranceTemp)
+				a.logger().Debug("group temp diff is less than tolerance, keeping fallback mode on", "diff", focusGroup.Diff, "tolerance", acBackToCoolingToleranceTemp)
 			}
 		} else if lastACMode == "Heat" {
-			log.Printf("Tolerance is %f", acBackToHeatingToleranceTemp)
+			a.logger().Debug("heating tolerance", "tolerance", acBackToHeatingToleranceTemp)
 
-			if focusGroup.diffSetpointTemp <= acBackToHeatingToleranceTemp {
-				log.Printf("Temp condition to turn AC back to Heat satisfied")
+			if focusGroup.Diff <= acBackToHeatingToleranceTemp {
+				a.logger().Info("temp condition to turn AC back to Heat satisfied", "diff", focusGroup.Diff)
 
-				err := a.SetACState("On", "Heat")
+				err := a.setPatchACMode("Heat")
 				if err != nil {
 					return err
 				}
 			} else {
-				log.Printf("Group temp diff %f is greater than tolerance %f, so keeping Fan mode on", focusGroup.diffSetpointTemp, acBackToHeatingToleranceTemp)
+				a.logger().Debug("group temp diff is greater than tolerance, keeping fallback mode on", "diff", focusGroup.Diff, "tolerance", acBackToHeatingToleranceTemp)
 			}
 		}
 	}
@@ -154,65 +188,49 @@ func (a *AirTouch) RunACModeSwitchingPatch() error {
 	return nil
 }
 
-func (a *AirTouch) getTemperature() (*groupTemperature, error) {
-	var focusGroup groupTemperature
-	var acMode string
-	var err error
-
-	// Init temp values
-	if a.AC.AcMode == "Cool" {
-		focusGroup.diffSetpointTemp = -50.0
-		acMode = "Cool"
-	} else if a.AC.AcMode == "Heat" {
-		focusGroup.diffSetpointTemp = 50.0
-		acMode = "Heat"
-	} else if a.AC.AcMode == "Fan" {
-		// We're on Fan now, but dig out what we were using previously.
-		acMode, err = a.ReadStringFromFile("current_ac_mode")
-		if err != nil {
-			return nil, errors.New("unable to determine if we're meant to be heating or cooling, try setting a mode?")
-		}
-
-		if acMode == "Cool" {
-			focusGroup.diffSetpointTemp = -50.0
-		} else if acMode == "Heat" {
-			focusGroup.diffSetpointTemp = 50.0
-		}
+// setPatchACMode switches the AC mode for the patch. Changes blocked to protect the compressor
+// have already been logged and are tried again on the next run.
+func (a *AirTouch) setPatchACMode(mode string) error {
+	err := a.SetACState("On", mode)
+	if errors.Is(err, ErrShortCycle) {
+		return nil
 	}
 
-	focusGroup.name = "NA"
-	focusGroup.currentTemp = 0.0
-
-	for _, g := range a.Groups {
-
-		// 22.2 - 23 = -0.8 under setpoint
-		// -50 < -0.8 (true), -0.8 < -0.6 (bit warmer, becomes new)
-		// 23 - 23 = 0
-		// -50 < -0.8 (true)
-		// -0.8 < 0 (true)
-		// 19.0 - 20.0 = -1, 50 > -1
-		tempDiffSetpointTemp := g.Temperature - float64(g.TargetSetpoint)
-
-		if g.PowerState == "On" && acMode == "Cool" && (focusGroup.diffSetpointTemp < tempDiffSetpointTemp) {
-			focusGroup.diffSetpointTemp = tempDiffSetpointTemp
-			focusGroup.name = g.Name
-			focusGroup.currentTemp = g.Temperature
-		} else if g.PowerState == "On" && acMode == "Heat" && (focusGroup.diffSetpointTemp > tempDiffSetpointTemp) {
-			focusGroup.diffSetpointTemp = tempDiffSetpointTemp
-			focusGroup.name = g.Name
-			focusGroup.currentTemp = g.Temperature
+	return err
+}
+
+// getTemperature finds the focus group using the configured FocusStrategy.
+func (a *AirTouch) getTemperature(config PatchConfig, state *RuleState) (*FocusGroup, error) {
+	acMode := a.AC.AcMode
+
+	if a.AC.AcMode == config.FallbackMode {
+		// We're on the fallback mode now, but dig out what we were using previously.
+		var err error
+		acMode, err = a.lastACMode(state)
+		if err != nil {
+			return nil, err
 		}
 	}
 
+	focusGroup := a.focusGroup(acMode == "Heat", config)
+
 	return &focusGroup, nil
 }
 
-func (a *AirTouch) EscapeProgramming() bool {
-	for _, g := range a.Groups {
-		if g.Name == "Nursery" && g.PowerState == "On" && g.ControlMethod == "PercentageControl" && g.OpenPercentage == 95 {
-			log.Printf("Criteria to skip programming met, keeping Fan on")
-			return true
-		}
+// lastACMode returns the mode to go back to from the fallback mode. Modes recorded by earlier versions in the
+// current_ac_mode file are picked up when the rule state has none.
+func (a *AirTouch) lastACMode(state *RuleState) (string, error) {
+	if mode := state.Get("current_ac_mode"); mode != "" {
+		return mode, nil
 	}
-	return false
+
+	mode, err := a.ReadStringFromFile("current_ac_mode")
+	if err != nil {
+		return "", errors.New("unable to determine if we're meant to be heating or cooling, try setting a mode?")
+	}
+
+	mode = strings.TrimSpace(mode)
+	state.Set("current_ac_mode", mode)
+
+	return mode, nil
 }
@@ -0,0 +1,219 @@
+package airtouch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// PatchConfig tunes RunACModeSwitchingPatch and GenerateGroupStatistics.
+type PatchConfig struct {
+	// CoolingTolerance is how far above its setpoint the focus group must be before the AC goes
+	// back from the fallback mode to Cool.
+	CoolingTolerance float64 `json:"cooling_tolerance"`
+	// HeatingTolerance is how far below its setpoint, as a negative number, the focus group must
+	// be before the AC goes back from the fallback mode to Heat.
+	HeatingTolerance float64 `json:"heating_tolerance"`
+	// ActiveOpenPercentage is the open percentage a group must be above to count as actively
+	// heated or cooled.
+	ActiveOpenPercentage int `json:"active_open_percentage"`
+	// AllowedModes are the AC modes the patch switches away from.
+	AllowedModes []string `json:"allowed_modes"`
+	// FallbackMode is the AC mode used once the focus group reaches its setpoint.
+	FallbackMode string `json:"fallback_mode"`
+	// FocusStrategy is the FocusStrategyMap strategy that picks the temperature the patch acts on.
+	// Defaults to Worst.
+	FocusStrategy string `json:"focus_strategy"`
+	// FocusWeights weights groups, by number, name or alias, for WeightedAverage. Defaults to 1.
+	FocusWeights map[string]float64 `json:"focus_weights"`
+	// MasterGroup is the group, by number, name or alias, used by Master.
+	MasterGroup string `json:"master_group"`
+	// UnreliableGroups, by number, name or alias, are ignored by every strategy.
+	UnreliableGroups []string `json:"unreliable_groups"`
+	// Overrides skip the patch while any of them is active.
+	Overrides []OverrideRule `json:"overrides"`
+}
+
+// DefaultPatchConfig returns the values the patch has always used, including its opt-out of
+// leaving the AC in the fallback mode while the Nursery is on at 95%.
+func DefaultPatchConfig() PatchConfig {
+	return PatchConfig{
+		CoolingTolerance: 0.3,
+		HeatingTolerance: -0.3,
+		// The default on percentage from Fan to Heat or Cool is 50, which isn't active.
+		ActiveOpenPercentage: 50,
+		AllowedModes:         []string{"Cool", "Heat"},
+		FallbackMode:         "Fan",
+		FocusStrategy:        "Worst",
+		Overrides: []OverrideRule{{
+			Reason:         "nursery on manual",
+			Group:          "Nursery",
+			Power:          "On",
+			ControlMethod:  "PercentageControl",
+			OpenPercentage: "95",
+		}},
+	}
+}
+
+// LoadPatchConfig reads a JSON patch config. Fields missing from the file keep their default.
+func LoadPatchConfig(path string) (PatchConfig, error) {
+	config := DefaultPatchConfig()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return config, &ValidationError{Field: "PatchConfig", Value: path, Reason: err.Error()}
+	}
+
+	return config, nil
+}
+
+// SetPatchConfig validates and replaces the patch config. It is used from the next patch run.
+func (a *AirTouch) SetPatchConfig(config PatchConfig) error {
+	err := a.validatePatchConfig(config)
+	if err != nil {
+		return err
+	}
+
+	a.patchMu.Lock()
+	defer a.patchMu.Unlock()
+
+	config = config.copy()
+	a.patchConfig = &config
+
+	return nil
+}
+
+// CurrentPatchConfig returns the patch config, reloading PatchConfigFile first if it changed.
+// Without either, DefaultPatchConfig is returned.
+func (a *AirTouch) CurrentPatchConfig() PatchConfig {
+	a.reloadPatchConfig()
+
+	a.patchMu.Lock()
+	defer a.patchMu.Unlock()
+
+	if a.patchConfig == nil {
+		return DefaultPatchConfig()
+	}
+
+	return a.patchConfig.copy()
+}
+
+// copy returns a config that shares no slices or maps with c.
+func (c PatchConfig) copy() PatchConfig {
+	c.AllowedModes = append([]string(nil), c.AllowedModes...)
+	c.UnreliableGroups = append([]string(nil), c.UnreliableGroups...)
+	c.Overrides = append([]OverrideRule(nil), c.Overrides...)
+
+	if c.FocusWeights != nil {
+		weights := make(map[string]float64, len(c.FocusWeights))
+		for group, weight := range c.FocusWeights {
+			weights[group] = weight
+		}
+		c.FocusWeights = weights
+	}
+
+	return c
+}
+
+// reloadPatchConfig loads PatchConfigFile when its modification time changes. A file that can't
+// be loaded leaves the current config in place.
+func (a *AirTouch) reloadPatchConfig() {
+	if a.PatchConfigFile == "" {
+		return
+	}
+
+	info, err := os.Stat(a.PatchConfigFile)
+	if err != nil {
+		a.logger().Warn("unable to read patch config, keeping current values", "file", a.PatchConfigFile, "error", err)
+		return
+	}
+
+	a.patchMu.Lock()
+	unchanged := info.ModTime().Equal(a.patchConfigModTime)
+	a.patchMu.Unlock()
+
+	if unchanged {
+		return
+	}
+
+	config, err := LoadPatchConfig(a.PatchConfigFile)
+	if err == nil {
+		err = a.SetPatchConfig(config)
+	}
+
+	if err != nil {
+		a.logger().Warn("unable to load patch config, keeping current values", "file", a.PatchConfigFile, "error", err)
+		return
+	}
+
+	a.patchMu.Lock()
+	a.patchConfigModTime = info.ModTime()
+	a.patchMu.Unlock()
+
+	a.logger().Info("loaded patch config", "file", a.PatchConfigFile)
+}
+
+// validatePatchConfig checks the tolerances point the right way and the modes make sense.
+func (a *AirTouch) validatePatchConfig(config PatchConfig) error {
+	if config.CoolingTolerance < 0 {
+		return &ValidationError{Field: "CoolingTolerance", Value: fmt.Sprint(config.CoolingTolerance), Reason: "must not be negative"}
+	}
+
+	if config.HeatingTolerance > 0 {
+		return &ValidationError{Field: "HeatingTolerance", Value: fmt.Sprint(config.HeatingTolerance), Reason: "must not be positive"}
+	}
+
+	if config.ActiveOpenPercentage < 0 || config.ActiveOpenPercentage > 100 {
+		return &ValidationError{Field: "ActiveOpenPercentage", Value: fmt.Sprint(config.ActiveOpenPercentage), Reason: "outside 0-100"}
+	}
+
+	// The patch only knows how to return to heating or cooling.
+	for _, mode := range config.AllowedModes {
+		if mode != "Cool" && mode != "Heat" {
+			return &ValidationError{Field: "AllowedModes", Value: mode, Reason: "must be Cool or Heat"}
+		}
+	}
+
+	if _, ok := a.ACModeMap()[config.FallbackMode]; !ok || config.allowsMode(config.FallbackMode) {
+		return &ValidationError{Field: "FallbackMode", Value: config.FallbackMode, Reason: "must be a mode other than the allowed modes"}
+	}
+
+	if _, ok := a.FocusStrategyMap()[config.FocusStrategy]; config.FocusStrategy != "" && !ok {
+		return &ValidationError{Field: "FocusStrategy", Value: config.FocusStrategy, Reason: "unknown focus strategy"}
+	}
+
+	for group, weight := range config.FocusWeights {
+		if weight < 0 {
+			return &ValidationError{Field: "FocusWeights", Value: group, Reason: "must not be negative"}
+		}
+	}
+
+	if config.FocusStrategy == "Master" && config.MasterGroup == "" {
+		return &ValidationError{Field: "MasterGroup", Reason: "required by the Master focus strategy"}
+	}
+
+	for _, rule := range config.Overrides {
+		err := a.validateOverrideRule(rule)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// allowsMode returns true if the patch switches away from mode.
+func (c PatchConfig) allowsMode(mode string) bool {
+	for _, allowed := range c.AllowedModes {
+		if allowed == mode {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,163 @@
+package airtouch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadPatchConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "patch.json")
+	if err := os.WriteFile(path, []byte(`{"cooling_tolerance": 0.5, "fallback_mode": "Dry"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadPatchConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.CoolingTolerance != 0.5 || config.FallbackMode != "Dry" {
+		t.Errorf("expected the file values, got %+v", config)
+	}
+
+	if config.HeatingTolerance != -0.3 || config.ActiveOpenPercentage != 50 || len(config.AllowedModes) != 2 {
+		t.Errorf("expected defaults for missing fields, got %+v", config)
+	}
+
+	// The Nursery opt-out is kept unless the file lists its own overrides.
+	if len(config.Overrides) != 1 || config.Overrides[0].Group != "Nursery" || config.Overrides[0].OpenPercentage != "95" {
+		t.Errorf("expected the default Nursery override, got %+v", config.Overrides)
+	}
+}
+
+func TestSetPatchConfigValidation(t *testing.T) {
+	a := AirTouch{}
+
+	invalid := []func(*PatchConfig){
+		func(c *PatchConfig) { c.CoolingTolerance = -1 },
+		func(c *PatchConfig) { c.HeatingTolerance = 1 },
+		func(c *PatchConfig) { c.ActiveOpenPercentage = 101 },
+		func(c *PatchConfig) { c.AllowedModes = []string{"Dry"} },
+		func(c *PatchConfig) { c.FallbackMode = "Cool" },
+		func(c *PatchConfig) { c.FallbackMode = "Sideways" },
+		func(c *PatchConfig) { c.FocusWeights = map[string]float64{"Living": -1} },
+	}
+
+	for i, modify := range invalid {
+		config := DefaultPatchConfig()
+		modify(&config)
+
+		if err := a.SetPatchConfig(config); !errors.Is(err, ErrValidation) {
+			t.Errorf("%d: expected ErrValidation, got %v", i, err)
+		}
+	}
+
+	if a.CurrentPatchConfig().CoolingTolerance != 0.3 {
+		t.Errorf("expected invalid configs to leave the default in place")
+	}
+
+	// The config in use shares nothing with the caller's.
+	config := DefaultPatchConfig()
+	config.FocusWeights = map[string]float64{"Living": 2}
+	config.UnreliableGroups = []string{"Garage"}
+	if err := a.SetPatchConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	config.FocusWeights["Living"] = 5
+	config.UnreliableGroups[0] = "Study"
+
+	current := a.CurrentPatchConfig()
+	current.FocusWeights["Living"] = 7
+
+	if got := a.CurrentPatchConfig(); got.FocusWeights["Living"] != 2 || got.UnreliableGroups[0] != "Garage" {
+		t.Errorf("expected the config to be copied, got %+v", got)
+	}
+}
+
+func TestPatchConfigReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "patch.json")
+	a := AirTouch{PatchConfigFile: path}
+
+	if err := os.WriteFile(path, []byte(`{"active_open_percentage": 60}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := a.CurrentPatchConfig().ActiveOpenPercentage; got != 60 {
+		t.Errorf("expected 60 from the file, got %d", got)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"active_open_percentage": 70}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make sure the modification time moves on filesystems with coarse timestamps.
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := a.CurrentPatchConfig().ActiveOpenPercentage; got != 70 {
+		t.Errorf("expected the changed file to be reloaded, got %d", got)
+	}
+
+	if err := os.WriteFile(path, []byte(`{`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	later = later.Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := a.CurrentPatchConfig().ActiveOpenPercentage; got != 70 {
+		t.Errorf("expected a broken file to keep the current config, got %d", got)
+	}
+}
+
+func TestPatchCoolingTolerance(t *testing.T) {
+	requests := 0
+	a := fakeConsole(t, func(request []byte) []byte {
+		requests++
+		return acStatusReply
+	})
+
+	a.RootTempDir = t.TempDir()
+	a.Confirmation = ConfirmNone
+	a.AC = AC{PowerState: "On", AcMode: "Fan"}
+	a.Groups = []Group{{Name: "Living", PowerState: "On", Temperature: 23.4, TargetSetpoint: 23}}
+
+	if err := a.WriteValueToFile("current_ac_mode", "Cool"); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultPatchConfig()
+	config.CoolingTolerance = 0.5
+	if err := a.SetPatchConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.RunACModeSwitchingPatch(); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 0 {
+		t.Errorf("expected Fan to be kept within the tolerance, got %d requests", requests)
+	}
+
+	config.CoolingTolerance = 0.3
+	if err := a.SetPatchConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.RunACModeSwitchingPatch(); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 1 {
+		t.Errorf("expected the AC to go back to Cool, got %d requests", requests)
+	}
+}
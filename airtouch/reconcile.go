@@ -0,0 +1,325 @@
+package airtouch
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DesiredState is the state a Reconciler converges the console to. Empty fields, and groups that
+// are not listed, are left alone.
+type DesiredState struct {
+	// ACPower is On or Off.
+	ACPower string
+	// ACMode is one of the ACModeMap modes.
+	ACMode string
+	// ACFanSpeed is one of the ACFanSpeedMap speeds.
+	ACFanSpeed string
+	// ACTargetSetpoint is in degrees.
+	ACTargetSetpoint string
+	// Groups holds the desired state of each managed group, by number, name or alias.
+	Groups []GroupChange
+}
+
+// Drift is a difference between the desired and live state.
+type Drift struct {
+	// Target is AC or the group number.
+	Target  string
+	Field   string
+	Desired string
+	Actual  string
+}
+
+// Reconciler periodically compares a DesiredState against the live state and sends the minimal
+// set of control messages to converge them. Targets the console rejects are backed off.
+type Reconciler struct {
+	AirTouch *AirTouch
+	// Interval is how often Run reconciles. Defaults to a minute.
+	Interval time.Duration
+	// MaxBackoff caps how long a rejected target is left before it is retried. Defaults to an hour.
+	MaxBackoff time.Duration
+
+	mu        sync.Mutex
+	desired   DesiredState
+	drift     []Drift
+	backoff   map[string]time.Duration
+	nextRetry map[string]time.Time
+	now       func() time.Time
+}
+
+// SetDesired replaces the desired state. It is used from the next reconcile.
+func (r *Reconciler) SetDesired(desired DesiredState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.desired = desired
+}
+
+// Drift returns the drift found by the last reconcile.
+func (r *Reconciler) Drift() []Drift {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Drift(nil), r.drift...)
+}
+
+// Run reconciles every Interval until ctx is cancelled. Errors are logged rather than returned
+// so that a temporarily unreachable console does not stop reconciling.
+func (r *Reconciler) Run(ctx context.Context) error {
+	interval := r.Interval
+	if interval == 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := r.Reconcile()
+		if err != nil {
+			r.AirTouch.logger().Warn("reconcile failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile refreshes the live state, sends control messages for any drift that is not backed
+// off and returns the drift that was found.
+func (r *Reconciler) Reconcile() ([]Drift, error) {
+	a := r.AirTouch
+
+	r.mu.Lock()
+	desired := r.desired
+	r.mu.Unlock()
+
+	if desired.ACPower != "" || desired.ACMode != "" || desired.ACFanSpeed != "" || desired.ACTargetSetpoint != "" {
+		err := a.GetACData()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(desired.Groups) > 0 {
+		err := a.GetGroupData()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var drift []Drift
+	var errs []error
+
+	acChange, acDrift := r.acDrift(desired)
+	drift = append(drift, acDrift...)
+
+	if len(acDrift) > 0 && r.ready("AC") {
+		err := a.SetAC(acChange)
+		r.record([]string{"AC"}, err)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	var changes []GroupChange
+	var targets []string
+
+	for _, want := range desired.Groups {
+		number, err := a.ResolveGroup(want.Group)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		change, groupDrift := r.groupDrift(number, want)
+		drift = append(drift, groupDrift...)
+
+		// A missing group drifts but there is nothing to send for it.
+		target := strconv.Itoa(number)
+		if change != (GroupChange{Group: target}) && r.ready(target) {
+			changes = append(changes, change)
+			targets = append(targets, target)
+		}
+	}
+
+	if len(changes) > 0 {
+		err := a.SetGroups(changes)
+
+		// Only back off the group the console did not change, if it is known. Changes are confirmed
+		// in order and confirmation stops at the first mismatch, so only the groups before it are
+		// known to have been applied.
+		var mismatchErr *MismatchError
+		if errors.As(err, &mismatchErr) && mismatchErr.Group != "" {
+			for _, target := range targets {
+				if target == mismatchErr.Group {
+					break
+				}
+				r.record([]string{target}, nil)
+			}
+			r.record([]string{mismatchErr.Group}, err)
+		} else {
+			r.record(targets, err)
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, d := range drift {
+		a.logger().Info("drift from desired state", "target", d.Target, "field", d.Field, "desired", d.Desired, "actual", d.Actual)
+	}
+
+	r.mu.Lock()
+	r.drift = drift
+	r.mu.Unlock()
+
+	return drift, errors.Join(errs...)
+}
+
+// acDrift compares the desired AC against the live AC and returns a change containing only the
+// fields that differ.
+func (r *Reconciler) acDrift(desired DesiredState) (ACChange, []Drift) {
+	ac := r.AirTouch.AC
+	var change ACChange
+	var drift []Drift
+
+	if desired.ACPower != "" && ac.PowerState != desired.ACPower {
+		change.Power = desired.ACPower
+		drift = append(drift, Drift{Target: "AC", Field: "PowerState", Desired: desired.ACPower, Actual: ac.PowerState})
+	}
+
+	// The mode of an AC that is meant to be off does not matter.
+	if desired.ACMode != "" && desired.ACPower != "Off" && ac.AcMode != desired.ACMode {
+		change.Mode = desired.ACMode
+		drift = append(drift, Drift{Target: "AC", Field: "AcMode", Desired: desired.ACMode, Actual: ac.AcMode})
+	}
+
+	if desired.ACFanSpeed != "" && desired.ACPower != "Off" && ac.AcFanSpeed != desired.ACFanSpeed {
+		change.FanSpeed = desired.ACFanSpeed
+		drift = append(drift, Drift{Target: "AC", Field: "AcFanSpeed", Desired: desired.ACFanSpeed, Actual: ac.AcFanSpeed})
+	}
+
+	if desired.ACTargetSetpoint != "" && desired.ACPower != "Off" && strconv.Itoa(ac.AcTargetSetpoint) != desired.ACTargetSetpoint {
+		change.TargetSetpoint = desired.ACTargetSetpoint
+		drift = append(drift, Drift{Target: "AC", Field: "AcTargetSetpoint", Desired: desired.ACTargetSetpoint, Actual: strconv.Itoa(ac.AcTargetSetpoint)})
+	}
+
+	return change, drift
+}
+
+// groupDrift compares a desired group against the live group and returns a change containing
+// only the fields that differ.
+func (r *Reconciler) groupDrift(number int, want GroupChange) (GroupChange, []Drift) {
+	target := strconv.Itoa(number)
+	change := GroupChange{Group: target}
+	var drift []Drift
+
+	group := r.AirTouch.groupByNumber(number)
+	if group == nil {
+		return change, []Drift{{Target: target, Field: "Group", Desired: want.Group, Actual: "missing"}}
+	}
+
+	if want.Power != "" && group.PowerState != want.Power {
+		change.Power = want.Power
+		drift = append(drift, Drift{Target: target, Field: "PowerState", Desired: want.Power, Actual: group.PowerState})
+	}
+
+	if want.TargetSetpoint != "" {
+		setpoint, _ := strconv.Atoi(want.TargetSetpoint)
+		if group.ControlMethod != "TemperatureControl" || group.TargetSetpoint != setpoint {
+			change.TargetSetpoint = want.TargetSetpoint
+			drift = append(drift, Drift{Target: target, Field: "TargetSetpoint", Desired: want.TargetSetpoint, Actual: strconv.Itoa(group.TargetSetpoint)})
+		}
+	}
+
+	// Spill groups and groups that are off do not report the percentage they were set to.
+	if want.OpenPercentage != "" && !group.Spill && group.PowerState != "Off" {
+		percentage, _ := strconv.Atoi(want.OpenPercentage)
+		if group.ControlMethod != "PercentageControl" || group.OpenPercentage != percentage {
+			change.OpenPercentage = want.OpenPercentage
+			drift = append(drift, Drift{Target: target, Field: "OpenPercentage", Desired: want.OpenPercentage, Actual: strconv.Itoa(group.OpenPercentage)})
+		}
+	}
+
+	return change, drift
+}
+
+// ready returns true if target is not being backed off or paused after a manual change.
+func (r *Reconciler) ready(target string) bool {
+	if pause, ok := r.AirTouch.Paused(target); ok {
+		r.AirTouch.logger().Debug("target changed manually, not reconciling", "target", target, "until", pause.Until)
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, ok := r.nextRetry[target]
+	if ok && r.clock().Before(next) {
+		r.AirTouch.logger().Debug("target backed off", "target", target, "until", next)
+		return false
+	}
+
+	return true
+}
+
+// record resets the backoff of targets that were changed and doubles it for targets the console
+// rejected. Other errors, such as an unreachable console, leave the backoff alone.
+func (r *Reconciler) record(targets []string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.backoff == nil {
+		r.backoff = make(map[string]time.Duration)
+		r.nextRetry = make(map[string]time.Time)
+	}
+
+	for _, target := range targets {
+		if err == nil {
+			delete(r.backoff, target)
+			delete(r.nextRetry, target)
+			continue
+		}
+
+		if !errors.Is(err, ErrRejected) {
+			continue
+		}
+
+		backoff := r.backoff[target] * 2
+		if backoff == 0 {
+			backoff = r.Interval
+			if backoff == 0 {
+				backoff = time.Minute
+			}
+		}
+
+		maxBackoff := r.MaxBackoff
+		if maxBackoff == 0 {
+			maxBackoff = time.Hour
+		}
+
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+
+		r.backoff[target] = backoff
+		r.nextRetry[target] = r.clock().Add(backoff)
+		r.AirTouch.logger().Warn("console rejected change, backing off", "target", target, "backoff", backoff, "error", err)
+	}
+}
+
+// clock returns the current time.
+func (r *Reconciler) clock() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+
+	return time.Now()
+}
@@ -0,0 +1,115 @@
+package airtouch
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReconcile(t *testing.T) {
+	var controls [][]byte
+	a := fakeConsole(t, func(request []byte) []byte {
+		switch request[5] {
+		case 0x1f:
+			return replyFrame(0x1f, groupNameSeed)
+		case 0x2a:
+			controls = append(controls, request)
+			return groupStatusReply
+		case 0x2b:
+			return groupStatusReply
+		default:
+			return acStatusReply
+		}
+	})
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	r := Reconciler{AirTouch: a, Interval: time.Minute, now: func() time.Time { return now }}
+
+	r.SetDesired(DesiredState{
+		ACPower: "On",
+		ACMode:  "Cool",
+		Groups: []GroupChange{
+			{Group: "Living", TargetSetpoint: "22"},
+			{Group: "1", OpenPercentage: "50"},
+		},
+	})
+
+	drift, err := r.Reconcile()
+	if err != nil || len(drift) != 0 || len(controls) != 0 {
+		t.Fatalf("expected no drift or control messages, got %+v, %d controls, %v", drift, len(controls), err)
+	}
+
+	r.SetDesired(DesiredState{
+		Groups: []GroupChange{
+			{Group: "Living", TargetSetpoint: "21"},
+			{Group: "1", OpenPercentage: "50"},
+		},
+	})
+
+	// The console ignores the change, so the group is backed off.
+	drift, err = r.Reconcile()
+	if !errors.Is(err, ErrRejected) {
+		t.Errorf("expected ErrRejected, got %v", err)
+	}
+
+	if len(drift) != 1 || drift[0].Target != "0" || drift[0].Field != "TargetSetpoint" {
+		t.Errorf("expected TargetSetpoint drift on group 0, got %+v", drift)
+	}
+
+	// Only group 0 is sent.
+	if len(controls) != 1 || controls[0][7] != 4 {
+		t.Fatalf("expected a single control message with one group, got %x", controls)
+	}
+
+	drift, err = r.Reconcile()
+	if err != nil || len(drift) != 1 || len(controls) != 1 {
+		t.Errorf("expected drift without a retry while backed off, got %+v, %d controls, %v", drift, len(controls), err)
+	}
+
+	now = now.Add(2 * time.Minute)
+
+	if _, err := r.Reconcile(); !errors.Is(err, ErrRejected) || len(controls) != 2 {
+		t.Errorf("expected a retry once the backoff passed, got %d controls, %v", len(controls), err)
+	}
+
+	if r.backoff["0"] != 2*time.Minute {
+		t.Errorf("expected the backoff to double, got %s", r.backoff["0"])
+	}
+}
+
+func TestReconcileMismatchBackoff(t *testing.T) {
+	a := fakeConsole(t, func(request []byte) []byte {
+		switch request[5] {
+		case 0x1f:
+			return replyFrame(0x1f, groupNameSeed)
+		case 0x2a, 0x2b:
+			return groupStatusReply
+		default:
+			return acStatusReply
+		}
+	})
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	r := Reconciler{AirTouch: a, now: func() time.Time { return now }}
+
+	// Group 1 was backed off before, and is due for a retry.
+	r.record([]string{"1"}, ErrRejected)
+	r.record([]string{"1"}, ErrRejected)
+	now = now.Add(3 * time.Minute)
+
+	r.SetDesired(DesiredState{
+		Groups: []GroupChange{
+			{Group: "0", TargetSetpoint: "21"},
+			{Group: "1", OpenPercentage: "60"},
+		},
+	})
+
+	if _, err := r.Reconcile(); !errors.Is(err, ErrRejected) {
+		t.Fatalf("expected ErrRejected, got %v", err)
+	}
+
+	// Confirmation stopped at group 0, so nothing is known about group 1.
+	if r.backoff["0"] != time.Minute || r.backoff["1"] != 2*time.Minute {
+		t.Errorf("expected group 0 backed off and group 1 left alone, got %v", r.backoff)
+	}
+}
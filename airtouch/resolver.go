@@ -0,0 +1,108 @@
+package airtouch
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ResolveGroup maps a group number, name or alias to a group number. Names and aliases are
+// matched case-insensitively, so aliases that differ only in case are an error, and a name shared
+// by several groups resolves to the lowest numbered. Names come from the cached group name table,
+// which is fetched from the console if it is empty or the name is not in it.
+func (a *AirTouch) ResolveGroup(group string) (int, error) {
+	group, err := a.resolveAlias(group)
+	if err != nil {
+		return 0, err
+	}
+
+	if number, err := strconv.Atoi(group); err == nil {
+		return number, nil
+	}
+
+	if number, ok := a.groupNumberByName(group); ok {
+		return number, nil
+	}
+
+	// The name table is empty or stale, so fetch it again and retry.
+	err = a.GetGroupName()
+	if err != nil {
+		return 0, err
+	}
+
+	if number, ok := a.groupNumberByName(group); ok {
+		return number, nil
+	}
+
+	return 0, &ValidationError{Field: "Group", Value: group, Reason: "unknown group, known groups are " + strings.Join(a.knownGroupNames(), ", ")}
+}
+
+// GetGroup returns the group for a number, name or alias from the last status reply.
+func (a *AirTouch) GetGroup(group string) (*Group, error) {
+	number, err := a.ResolveGroup(group)
+	if err != nil {
+		return nil, err
+	}
+
+	g := a.groupByNumber(number)
+	if g == nil {
+		return nil, &ValidationError{Field: "Group", Value: group, Reason: "not in the last group status"}
+	}
+
+	return g, nil
+}
+
+// resolveAlias returns the target of the alias group matches, or group itself if it isn't one.
+func (a *AirTouch) resolveAlias(group string) (string, error) {
+	group = strings.TrimSpace(group)
+
+	var matches []string
+	for alias := range a.GroupAliases {
+		if strings.EqualFold(alias, group) {
+			matches = append(matches, alias)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return group, nil
+	case 1:
+		return strings.TrimSpace(a.GroupAliases[matches[0]]), nil
+	}
+
+	sort.Strings(matches)
+
+	return "", &ValidationError{Field: "GroupAliases", Value: group, Reason: "aliases " + strings.Join(matches, ", ") + " differ only in case"}
+}
+
+// groupNumberByName looks a name up in the cached group name table, in group number order.
+func (a *AirTouch) groupNumberByName(name string) (int, bool) {
+	for _, number := range a.knownGroupNumbers() {
+		if strings.EqualFold(a.groupNames[number], name) {
+			return number, true
+		}
+	}
+
+	return 0, false
+}
+
+// knownGroupNumbers returns the numbers in the cached group name table, sorted.
+func (a *AirTouch) knownGroupNumbers() []int {
+	var numbers []int
+	for number := range a.groupNames {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	return numbers
+}
+
+// knownGroupNames returns the cached group names in group number order.
+func (a *AirTouch) knownGroupNames() []string {
+	var names []string
+	for _, number := range a.knownGroupNumbers() {
+		names = append(names, a.groupNames[number])
+	}
+
+	return names
+}
@@ -0,0 +1,74 @@
+package airtouch
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestResolveGroup(t *testing.T) {
+	requests := 0
+	a := fakeConsole(t, func(request []byte) []byte {
+		requests++
+		return replyFrame(0x1f, groupNameSeed)
+	})
+	a.GroupAliases = map[string]string{"Lounge": "living", "Master": "1"}
+
+	tests := []struct {
+		group    string
+		expected int
+	}{
+		{"1", 1},
+		{"Living", 0},
+		{"LIVING", 0},
+		{" bed ", 1},
+		{"lounge", 0},
+		{"master", 1},
+	}
+
+	for _, test := range tests {
+		number, err := a.ResolveGroup(test.group)
+		if err != nil {
+			t.Errorf("%q: %v", test.group, err)
+		} else if number != test.expected {
+			t.Errorf("%q: expected group %d, got %d", test.group, test.expected, number)
+		}
+	}
+
+	if requests != 1 {
+		t.Errorf("expected the name table to be fetched once, got %d requests", requests)
+	}
+}
+
+func TestResolveUnknownGroup(t *testing.T) {
+	a := fakeConsole(t, func(request []byte) []byte {
+		return replyFrame(0x1f, groupNameSeed)
+	})
+
+	_, err := a.ResolveGroup("Attic")
+	if !errors.Is(err, ErrValidation) || !strings.Contains(err.Error(), "Living, Bed") {
+		t.Errorf("expected an unknown group error listing the known groups, got %v", err)
+	}
+}
+
+func TestResolveGroupCaseCollisions(t *testing.T) {
+	a := &AirTouch{
+		GroupAliases: map[string]string{"kids": "Bed", "Kids": "Living"},
+		groupNames:   map[int]string{0: "Living", 1: "bed", 2: "Bed"},
+	}
+
+	if _, err := a.ResolveGroup("KIDS"); !errors.Is(err, ErrValidation) || !strings.Contains(err.Error(), "Kids, kids") {
+		t.Errorf("expected aliases differing only in case to be rejected, got %v", err)
+	}
+
+	if a.groupMatches("kids", Group{Number: 0, Name: "Living"}) {
+		t.Error("expected an ambiguous alias to match nothing")
+	}
+
+	// Names shared by several groups resolve to the lowest numbered every time.
+	for i := 0; i < 20; i++ {
+		if number, err := a.ResolveGroup("BED"); err != nil || number != 1 {
+			t.Fatalf("expected group 1, got %d, %v", number, err)
+		}
+	}
+}
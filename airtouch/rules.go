@@ -0,0 +1,422 @@
+package airtouch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// TriggerEvent fires a rule on state change events.
+	TriggerEvent = "Event"
+	// TriggerSchedule fires a rule every Interval.
+	TriggerSchedule = "Schedule"
+	// TriggerThreshold fires a rule when a value crosses a threshold.
+	TriggerThreshold = "Threshold"
+)
+
+// Trigger decides when a rule is evaluated.
+type Trigger struct {
+	// Type is one of TriggerEvent, TriggerSchedule or TriggerThreshold.
+	Type string
+	// Events limits TriggerEvent to these event types. Empty fires on every event.
+	Events []string
+	// Interval is how often TriggerSchedule fires.
+	Interval time.Duration
+	// Value reads the value TriggerThreshold compares against Threshold. It returns false when
+	// there is no value, such as a group without a sensor.
+	Value     func(Snapshot) (float64, bool)
+	Threshold float64
+	// Rising fires TriggerThreshold when the value goes above Threshold, otherwise when it goes
+	// below.
+	Rising bool
+}
+
+// Condition is checked against the current snapshot before a rule's actions run.
+type Condition func(snapshot Snapshot, state *RuleState) bool
+
+// Action changes the console through the control APIs. It may keep values in state.
+type Action func(a *AirTouch, state *RuleState) error
+
+// Rule is an automation run by a RuleEngine.
+type Rule struct {
+	// Name identifies the rule and its persisted state. Letters, numbers, - and _ only.
+	Name       string
+	Trigger    Trigger
+	Conditions []Condition
+	Actions    []Action
+	// Targets lists the AC, as ScheduleTargetAC, and the group numbers, names or aliases the
+	// actions change. The rule doesn't fire while any of them is paused after a manual change.
+	Targets []string
+}
+
+// RuleState is kept in RootTempDir for each rule so that it survives restarts.
+type RuleState struct {
+	Enabled   bool              `json:"enabled"`
+	Values    map[string]string `json:"values"`
+	LastFired time.Time         `json:"last_fired"`
+	LastError string            `json:"last_error"`
+}
+
+// Get returns a value kept by the rule.
+func (s *RuleState) Get(key string) string {
+	return s.Values[key]
+}
+
+// Set keeps a value for the rule.
+func (s *RuleState) Set(key string, value string) {
+	if s.Values == nil {
+		s.Values = make(map[string]string)
+	}
+
+	s.Values[key] = value
+}
+
+var ruleName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// RuleEngine runs rules against the console. Rules are enabled when first added.
+type RuleEngine struct {
+	AirTouch *AirTouch
+	// Interval is how often Run refreshes the state and checks schedule and threshold triggers.
+	// Defaults to a minute.
+	Interval time.Duration
+
+	mu     sync.Mutex
+	rules  []Rule
+	states map[string]*RuleState
+	now    func() time.Time
+}
+
+// Add registers a rule and loads its persisted state.
+func (e *RuleEngine) Add(rule Rule) error {
+	if !ruleName.MatchString(rule.Name) {
+		return &ValidationError{Field: "Rule", Value: rule.Name, Reason: "name must be letters, numbers, - and _"}
+	}
+
+	switch rule.Trigger.Type {
+	case TriggerEvent:
+	case TriggerSchedule:
+		if rule.Trigger.Interval <= 0 {
+			return &ValidationError{Field: "Interval", Value: rule.Trigger.Interval.String(), Reason: "schedule triggers need a positive interval"}
+		}
+	case TriggerThreshold:
+		if rule.Trigger.Value == nil {
+			return &ValidationError{Field: "Value", Value: rule.Name, Reason: "threshold triggers need a value"}
+		}
+	default:
+		return &ValidationError{Field: "Trigger", Value: rule.Trigger.Type, Reason: "unknown trigger"}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.states == nil {
+		e.states = make(map[string]*RuleState)
+	}
+
+	// Names that differ only in case share a state file.
+	for _, existing := range e.rules {
+		if strings.EqualFold(existing.Name, rule.Name) {
+			return &ValidationError{Field: "Rule", Value: rule.Name, Reason: "already added as " + existing.Name}
+		}
+	}
+
+	e.rules = append(e.rules, rule)
+	e.states[rule.Name] = e.AirTouch.loadRuleState(rule.Name)
+
+	return nil
+}
+
+// SetEnabled enables or disables a rule and persists the switch.
+func (e *RuleEngine) SetEnabled(name string, enabled bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	state, ok := e.states[name]
+	if !ok {
+		return &ValidationError{Field: "Rule", Value: name, Reason: "unknown rule"}
+	}
+
+	state.Enabled = enabled
+	e.AirTouch.logger().Info("rule switched", "rule", name, "enabled", enabled)
+
+	return e.AirTouch.saveRuleState(name, state)
+}
+
+// State returns a copy of a rule's state.
+func (e *RuleEngine) State(name string) (RuleState, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	state, ok := e.states[name]
+	if !ok {
+		return RuleState{}, false
+	}
+
+	copied := *state
+	copied.Values = make(map[string]string)
+	for k, v := range state.Values {
+		copied.Values[k] = v
+	}
+
+	return copied, true
+}
+
+// Run refreshes the state and checks schedule and threshold triggers every Interval, and
+// checks event triggers as events arrive, until ctx is cancelled. Errors are logged rather than
+// returned.
+func (e *RuleEngine) Run(ctx context.Context) error {
+	interval := e.Interval
+	if interval == 0 {
+		interval = time.Minute
+	}
+
+	// Events are queued so that rules whose actions cause events don't run re-entrantly.
+	events := make(chan Event, 64)
+	unsubscribe := e.AirTouch.Subscribe(func(event Event) {
+		select {
+		case events <- event:
+		default:
+			e.AirTouch.logger().Warn("rule engine busy, dropping event", "event", event.Type)
+		}
+	})
+	defer unsubscribe()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	err := e.Tick()
+	if err != nil {
+		e.AirTouch.logger().Warn("rule engine tick failed", "error", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event := <-events:
+			err := e.HandleEvent(event)
+			if err != nil {
+				e.AirTouch.logger().Warn("rule engine event failed", "event", event.Type, "error", err)
+			}
+		case <-ticker.C:
+			err := e.Tick()
+			if err != nil {
+				e.AirTouch.logger().Warn("rule engine tick failed", "error", err)
+			}
+		}
+	}
+}
+
+// Tick refreshes the group and AC data and fires any schedule or threshold rules that are due.
+func (e *RuleEngine) Tick() error {
+	a := e.AirTouch
+
+	err := a.GetGroupData()
+	if err != nil {
+		return err
+	}
+
+	err = a.GetACData()
+	if err != nil {
+		return err
+	}
+
+	snapshot := a.Snapshot()
+	var errs []error
+
+	for _, rule := range e.enabledRules() {
+		if !e.due(rule, snapshot) {
+			continue
+		}
+
+		errs = append(errs, e.fire(rule, snapshot))
+	}
+
+	return errors.Join(errs...)
+}
+
+// HandleEvent fires the event rules that listen for the event.
+func (e *RuleEngine) HandleEvent(event Event) error {
+	snapshot := e.AirTouch.Snapshot()
+	var errs []error
+
+	for _, rule := range e.enabledRules() {
+		if rule.Trigger.Type != TriggerEvent || !listensFor(rule.Trigger, event.Type) {
+			continue
+		}
+
+		errs = append(errs, e.fire(rule, snapshot))
+	}
+
+	return errors.Join(errs...)
+}
+
+// enabledRules returns the rules that are switched on.
+func (e *RuleEngine) enabledRules() []Rule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var rules []Rule
+	for _, rule := range e.rules {
+		if e.states[rule.Name].Enabled {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules
+}
+
+// listensFor returns true if an event trigger fires on eventType.
+func listensFor(trigger Trigger, eventType string) bool {
+	if len(trigger.Events) == 0 {
+		return true
+	}
+
+	for _, t := range trigger.Events {
+		if t == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// due returns true if a schedule rule's interval has passed, or a threshold rule's value has
+// crossed its threshold since the last tick.
+func (e *RuleEngine) due(rule Rule, snapshot Snapshot) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	state := e.states[rule.Name]
+
+	switch rule.Trigger.Type {
+	case TriggerSchedule:
+		return !e.clock().Before(state.LastFired.Add(rule.Trigger.Interval))
+	case TriggerThreshold:
+		value, ok := rule.Trigger.Value(snapshot)
+		if !ok {
+			return false
+		}
+
+		crossed := value < rule.Trigger.Threshold
+		if rule.Trigger.Rising {
+			crossed = value > rule.Trigger.Threshold
+		}
+
+		// Only the change from one side of the threshold to the other fires.
+		was := state.Get("crossed") == "true"
+		if crossed == was {
+			return false
+		}
+
+		state.Set("crossed", strconv.FormatBool(crossed))
+		err := e.AirTouch.saveRuleState(rule.Name, state)
+		if err != nil {
+			e.AirTouch.logger().Warn("unable to save rule state", "rule", rule.Name, "error", err)
+		}
+
+		return crossed
+	}
+
+	return false
+}
+
+// fire checks a rule's conditions and runs its actions, then persists its state. Actions work on
+// a copy of the state so that State and SetEnabled can be called while they run.
+func (e *RuleEngine) fire(rule Rule, snapshot Snapshot) error {
+	state, _ := e.State(rule.Name)
+
+	log := e.AirTouch.logger().With("rule", rule.Name)
+
+	for _, target := range rule.Targets {
+		if pause, ok := e.AirTouch.Paused(target); ok {
+			log.Debug("target changed manually, not firing", "target", target, "until", pause.Until)
+			return nil
+		}
+	}
+
+	for _, condition := range rule.Conditions {
+		if !condition(snapshot, &state) {
+			log.Debug("rule conditions not met")
+			return nil
+		}
+	}
+
+	log.Info("rule fired", "trigger", rule.Trigger.Type)
+
+	var errs []error
+	for _, action := range rule.Actions {
+		err := action(e.AirTouch, &state)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	err := errors.Join(errs...)
+
+	state.LastFired = e.clock()
+	state.LastError = ""
+	if err != nil {
+		state.LastError = err.Error()
+	}
+
+	e.mu.Lock()
+	state.Enabled = e.states[rule.Name].Enabled
+	e.states[rule.Name] = &state
+	saveErr := e.AirTouch.saveRuleState(rule.Name, &state)
+	e.mu.Unlock()
+
+	if saveErr != nil {
+		log.Warn("unable to save rule state", "error", saveErr)
+	}
+
+	return err
+}
+
+// clock returns the current time.
+func (e *RuleEngine) clock() time.Time {
+	if e.now != nil {
+		return e.now()
+	}
+
+	return time.Now()
+}
+
+// ruleStateFile is the file in RootTempDir a rule's state is kept in.
+func ruleStateFile(name string) string {
+	return "rule_" + strings.ToLower(name) + ".json"
+}
+
+// loadRuleState reads a rule's persisted state. A rule without any is enabled.
+func (a *AirTouch) loadRuleState(name string) *RuleState {
+	state := &RuleState{Enabled: true}
+
+	value, err := a.ReadStringFromFile(ruleStateFile(name))
+	if err != nil {
+		return state
+	}
+
+	err = json.Unmarshal([]byte(value), state)
+	if err != nil {
+		a.logger().Warn("ignoring unreadable rule state", "rule", name, "error", err)
+		return &RuleState{Enabled: true}
+	}
+
+	return state
+}
+
+// saveRuleState persists a rule's state.
+func (a *AirTouch) saveRuleState(name string, state *RuleState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return a.WriteValueToFile(ruleStateFile(name), string(data))
+}
@@ -0,0 +1,238 @@
+package airtouch
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// ruleConsole is a fake console that answers every query and counts AC control messages.
+func ruleConsole(t *testing.T, acControls *int) *AirTouch {
+	a := fakeConsole(t, func(request []byte) []byte {
+		switch request[5] {
+		case 0x1f:
+			return replyFrame(0x1f, groupNameSeed)
+		case 0x2a, 0x2b:
+			return groupStatusReply
+		case 0x2c:
+			*acControls++
+		}
+		return acStatusReply
+	})
+
+	a.RootTempDir = t.TempDir()
+	a.Confirmation = ConfirmNone
+
+	return a
+}
+
+func TestRuleEngineSchedule(t *testing.T) {
+	acControls := 0
+	a := ruleConsole(t, &acControls)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	e := RuleEngine{AirTouch: a, now: func() time.Time { return now }}
+
+	fired := 0
+	err := e.Add(Rule{
+		Name:    "count",
+		Trigger: Trigger{Type: TriggerSchedule, Interval: 10 * time.Minute},
+		Conditions: []Condition{func(snapshot Snapshot, state *RuleState) bool {
+			return snapshot.ACs[0].Mode == "Cool"
+		}},
+		Actions: []Action{func(a *AirTouch, state *RuleState) error {
+			fired++
+			state.Set("fired", "yes")
+			return nil
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, step := range []time.Duration{0, 5 * time.Minute, 5 * time.Minute} {
+		now = now.Add(step)
+		if err := e.Tick(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if fired != 2 {
+		t.Errorf("expected the rule to fire at 0 and 10 minutes, fired %d times", fired)
+	}
+
+	// State and the enable switch survive a restart.
+	if err := e.SetEnabled("count", false); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := RuleEngine{AirTouch: a, now: e.now}
+	if err := restarted.Add(Rule{Name: "count", Trigger: Trigger{Type: TriggerSchedule, Interval: time.Minute}}); err != nil {
+		t.Fatal(err)
+	}
+
+	state, _ := restarted.State("count")
+	if state.Enabled || state.Get("fired") != "yes" || !state.LastFired.Equal(now) {
+		t.Errorf("expected the persisted state, got %+v", state)
+	}
+
+	now = now.Add(time.Hour)
+	if err := e.Tick(); err != nil {
+		t.Fatal(err)
+	}
+
+	if fired != 2 {
+		t.Errorf("expected a disabled rule not to fire, fired %d times", fired)
+	}
+}
+
+func TestRuleEngineThresholdAndEvents(t *testing.T) {
+	acControls := 0
+	a := ruleConsole(t, &acControls)
+	e := RuleEngine{AirTouch: a}
+
+	temperature := 20.0
+	var fired []string
+	record := func(name string) Action {
+		return func(a *AirTouch, state *RuleState) error {
+			fired = append(fired, name)
+			return nil
+		}
+	}
+
+	rules := []Rule{
+		{
+			Name: "hot",
+			Trigger: Trigger{
+				Type:      TriggerThreshold,
+				Value:     func(Snapshot) (float64, bool) { return temperature, true },
+				Threshold: 25,
+				Rising:    true,
+			},
+			Actions: []Action{record("hot")},
+		},
+		{
+			Name:    "mode",
+			Trigger: Trigger{Type: TriggerEvent, Events: []string{EventACMode}},
+			Actions: []Action{record("mode"), func(a *AirTouch, state *RuleState) error {
+				return errors.New("broken")
+			}},
+		},
+	}
+
+	for _, rule := range rules {
+		if err := e.Add(rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, value := range []float64{20, 26, 27, 24, 26} {
+		temperature = value
+		if err := e.Tick(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := e.HandleEvent(Event{Type: EventACPower}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.HandleEvent(Event{Type: EventACMode}); err == nil {
+		t.Error("expected the failing action's error")
+	}
+
+	expected := []string{"hot", "hot", "mode"}
+	if len(fired) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, fired)
+	}
+
+	for i := range expected {
+		if fired[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, fired)
+		}
+	}
+
+	if state, _ := e.State("mode"); state.LastError != "broken" {
+		t.Errorf("expected the error to be recorded, got %q", state.LastError)
+	}
+}
+
+func TestRuleValidation(t *testing.T) {
+	e := RuleEngine{AirTouch: &AirTouch{RootTempDir: t.TempDir()}}
+
+	for _, rule := range []Rule{
+		{Name: "../escape", Trigger: Trigger{Type: TriggerEvent}},
+		{Name: "sometimes", Trigger: Trigger{Type: "Whenever"}},
+		{Name: "never", Trigger: Trigger{Type: TriggerSchedule}},
+		{Name: "nothing", Trigger: Trigger{Type: TriggerThreshold}},
+	} {
+		if err := e.Add(rule); !errors.Is(err, ErrValidation) {
+			t.Errorf("%s: expected ErrValidation, got %v", rule.Name, err)
+		}
+	}
+
+	// Names that differ only in case would share a state file.
+	if err := e.Add(Rule{Name: "Morning", Trigger: Trigger{Type: TriggerEvent}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Add(Rule{Name: "morning", Trigger: Trigger{Type: TriggerEvent}}); !errors.Is(err, ErrValidation) {
+		t.Errorf("expected a name differing only in case to fail, got %v", err)
+	}
+
+	if err := e.SetEnabled("missing", true); !errors.Is(err, ErrValidation) {
+		t.Errorf("expected an unknown rule to fail, got %v", err)
+	}
+}
+
+func TestModeSwitchingRule(t *testing.T) {
+	acControls := 0
+	a := ruleConsole(t, &acControls)
+	e := RuleEngine{AirTouch: a}
+
+	if err := e.Add(a.ModeSwitchingRule()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Tick(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The groups are above their setpoints so the AC stays on Cool.
+	if acControls != 0 {
+		t.Errorf("expected the AC to be left alone, got %d control messages", acControls)
+	}
+
+	state, _ := e.State(ModeSwitchingRuleName)
+	if state.Get("current_ac_mode") != "Cool" {
+		t.Errorf("expected the rule to record Cool, got %+v", state)
+	}
+
+	// RunACModeSwitchingPatch shares the rule's state and switch.
+	if err := e.SetEnabled(ModeSwitchingRuleName, false); err != nil {
+		t.Fatal(err)
+	}
+
+	a.AC.AcMode = "Fan"
+	a.Groups = []Group{{Name: "Living", PowerState: "On", Temperature: 25, TargetSetpoint: 22}}
+
+	if err := a.RunACModeSwitchingPatch(); err != nil {
+		t.Fatal(err)
+	}
+
+	if acControls != 0 {
+		t.Errorf("expected a disabled rule to skip the patch, got %d control messages", acControls)
+	}
+
+	if err := e.SetEnabled(ModeSwitchingRuleName, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.RunACModeSwitchingPatch(); err != nil {
+		t.Fatal(err)
+	}
+
+	if acControls != 1 {
+		t.Errorf("expected the patch to switch back to Cool, got %d control messages", acControls)
+	}
+}
@@ -0,0 +1,384 @@
+package airtouch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sceneDir is the directory under RootTempDir scenes are stored in, one <name>.json file each.
+const sceneDir = "scenes"
+
+// sceneNamePattern keeps scene names usable as file names.
+var sceneNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 _-]*$`)
+
+// Scene is a named configuration of the AC and every group that can be restored in one go.
+type Scene struct {
+	Name   string       `json:"name"`
+	Saved  time.Time    `json:"saved"`
+	AC     SceneAC      `json:"ac"`
+	Groups []SceneGroup `json:"groups"`
+}
+
+// SceneAC is the configuration of the AC in a scene.
+type SceneAC struct {
+	Power          string `json:"power"`
+	Mode           string `json:"mode"`
+	FanSpeed       string `json:"fan_speed,omitempty"`
+	TargetSetpoint int    `json:"target_setpoint"`
+}
+
+// SceneGroup is the configuration of a group in a scene. Only the setpoint or percentage of the
+// group's control method is restored. OpenPercentage is nil for a spill group taken from a
+// snapshot without its reported percentage, and the percentage is then left as it is.
+type SceneGroup struct {
+	Number         int    `json:"number"`
+	Name           string `json:"name"`
+	Power          string `json:"power"`
+	ControlMethod  string `json:"control_method"`
+	TargetSetpoint int    `json:"target_setpoint"`
+	OpenPercentage *int   `json:"open_percentage,omitempty"`
+}
+
+// SceneFromSnapshot captures the configuration in a snapshot as a scene.
+func SceneFromSnapshot(name string, snapshot Snapshot) Scene {
+	scene := Scene{Name: name, Saved: snapshot.Timestamp}
+
+	if len(snapshot.ACs) > 0 {
+		ac := snapshot.ACs[0]
+		scene.AC = SceneAC{
+			Power:          ac.Power,
+			Mode:           ac.Mode,
+			FanSpeed:       ac.FanSpeed,
+			TargetSetpoint: ac.TargetSetpoint,
+		}
+	}
+
+	for _, g := range snapshot.Groups {
+		group := SceneGroup{
+			Number:         g.Number,
+			Name:           g.Name,
+			Power:          g.Power,
+			ControlMethod:  g.ControlMethod,
+			TargetSetpoint: g.TargetSetpoint,
+		}
+
+		if percentage, ok := g.setPercentage(); ok {
+			group.OpenPercentage = &percentage
+		}
+
+		scene.Groups = append(scene.Groups, group)
+	}
+
+	return scene
+}
+
+// DesiredState returns the scene as the state a Reconciler converges to.
+func (s Scene) DesiredState() DesiredState {
+	desired := DesiredState{
+		ACPower:    s.AC.Power,
+		ACMode:     s.AC.Mode,
+		ACFanSpeed: s.AC.FanSpeed,
+	}
+
+	if s.AC.Power != "" {
+		desired.ACTargetSetpoint = strconv.Itoa(s.AC.TargetSetpoint)
+	}
+
+	for _, g := range s.Groups {
+		change := GroupChange{Group: strconv.Itoa(g.Number), Power: g.Power}
+
+		if g.ControlMethod == "TemperatureControl" {
+			change.TargetSetpoint = strconv.Itoa(g.TargetSetpoint)
+		} else if g.OpenPercentage != nil {
+			change.OpenPercentage = strconv.Itoa(*g.OpenPercentage)
+		}
+
+		desired.Groups = append(desired.Groups, change)
+	}
+
+	return desired
+}
+
+// CaptureScene refreshes the AC and groups and captures them as a scene.
+func (a *AirTouch) CaptureScene(name string) (Scene, error) {
+	err := validateSceneName(name)
+	if err != nil {
+		return Scene{}, err
+	}
+
+	err = a.GetGroupData()
+	if err != nil {
+		return Scene{}, err
+	}
+
+	err = a.GetACData()
+	if err != nil {
+		return Scene{}, err
+	}
+
+	return SceneFromSnapshot(name, a.Snapshot()), nil
+}
+
+// SaveScene stores a scene in RootTempDir, replacing any scene with the same name.
+func (a *AirTouch) SaveScene(scene Scene) error {
+	err := validateSceneName(scene.Name)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Join(a.RootTempDir, sceneDir), 0755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(scene, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return a.WriteValueToFile(filepath.Join(sceneDir, scene.Name+".json"), string(data))
+}
+
+// LoadScene reads a stored scene.
+func (a *AirTouch) LoadScene(name string) (Scene, error) {
+	var scene Scene
+
+	err := validateSceneName(name)
+	if err != nil {
+		return scene, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(a.RootTempDir, sceneDir, name+".json"))
+	if err != nil {
+		return scene, err
+	}
+
+	err = json.Unmarshal(data, &scene)
+	if err != nil {
+		return scene, &ValidationError{Field: "Scene", Value: name, Reason: err.Error()}
+	}
+
+	return scene, nil
+}
+
+// Scenes returns the names of the stored scenes, sorted.
+func (a *AirTouch) Scenes() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(a.RootTempDir, sceneDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if ok && !entry.IsDir() {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// DeleteScene removes a stored scene.
+func (a *AirTouch) DeleteScene(name string) error {
+	err := validateSceneName(name)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(filepath.Join(a.RootTempDir, sceneDir, name+".json"))
+}
+
+// PreviewScene refreshes the AC and groups and returns what applying a scene would change.
+func (a *AirTouch) PreviewScene(scene Scene) ([]Drift, error) {
+	_, _, drift, err := a.sceneChanges(scene)
+
+	return drift, err
+}
+
+// ApplyScene restores a scene with at most one ACControl and one GroupControl message, and
+// returns what it changed. Every change is validated, group setpoints against the scene's mode,
+// before anything is sent. If a message fails, what was sent is reverted so that the console is
+// left as it was, and the error includes any failure to revert. Scenes are applied on request, so
+// targets paused after a manual change are changed too.
+func (a *AirTouch) ApplyScene(scene Scene) ([]Drift, error) {
+	acChange, groupChanges, drift, err := a.sceneChanges(scene)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := a.AC.AcMode
+	if acChange != (ACChange{}) {
+		err = a.validateACChange(acChange)
+		if err != nil {
+			return nil, err
+		}
+
+		if acChange.Mode != "" {
+			mode = acChange.Mode
+		}
+	}
+
+	for _, change := range groupChanges {
+		number, _ := strconv.Atoi(change.Group)
+
+		err = a.validateGroupChangeInMode(number, change, mode)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	a.logger().Info("applying scene", "scene", scene.Name, "changes", len(drift))
+
+	previousAC := a.AC
+	previousGroups := append([]Group(nil), a.Groups...)
+
+	if acChange != (ACChange{}) {
+		err = a.SetAC(acChange)
+		if errors.Is(err, ErrValidation) || errors.Is(err, ErrShortCycle) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, errors.Join(err, a.revertScene(previousAC, acChange, previousGroups, nil))
+		}
+	}
+
+	if len(groupChanges) > 0 {
+		err = a.SetGroups(groupChanges)
+		if err != nil {
+			return nil, errors.Join(err, a.revertScene(previousAC, acChange, previousGroups, groupChanges))
+		}
+	}
+
+	return drift, nil
+}
+
+// revertScene puts back the fields a failed ApplyScene sent, from the AC and groups as they were
+// before. The groups are reverted before the AC so that their setpoints suit its mode.
+func (a *AirTouch) revertScene(previousAC AC, acChange ACChange, previousGroups []Group, groupChanges []GroupChange) error {
+	a.logger().Warn("scene failed, reverting")
+
+	var errs []error
+	var reverts []GroupChange
+
+	for _, change := range groupChanges {
+		number, _ := strconv.Atoi(change.Group)
+
+		var previous *Group
+		for i := range previousGroups {
+			if previousGroups[i].Number == number {
+				previous = &previousGroups[i]
+			}
+		}
+
+		if previous == nil {
+			continue
+		}
+
+		revert := GroupChange{Group: change.Group}
+		if change.Power != "" {
+			revert.Power = previous.PowerState
+		}
+
+		if change.TargetSetpoint != "" || change.OpenPercentage != "" {
+			if previous.ControlMethod == "TemperatureControl" {
+				revert.TargetSetpoint = strconv.Itoa(previous.TargetSetpoint)
+			} else {
+				revert.OpenPercentage = strconv.Itoa(previous.OpenPercentage)
+			}
+		}
+
+		reverts = append(reverts, revert)
+	}
+
+	if len(reverts) > 0 {
+		err := a.SetGroups(reverts)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reverting groups: %w", err))
+		}
+	}
+
+	var revert ACChange
+	if acChange.Power != "" {
+		revert.Power = previousAC.PowerState
+	}
+
+	if acChange.Mode != "" {
+		revert.Mode = previousAC.AcMode
+	}
+
+	if acChange.FanSpeed != "" {
+		revert.FanSpeed = previousAC.AcFanSpeed
+	}
+
+	if acChange.TargetSetpoint != "" {
+		revert.TargetSetpoint = strconv.Itoa(previousAC.AcTargetSetpoint)
+	}
+
+	if revert != (ACChange{}) {
+		err := a.SetAC(revert)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reverting AC: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// sceneChanges refreshes the AC and groups and returns the minimal changes that restore a scene.
+// Groups in the scene that the console no longer has are an error.
+func (a *AirTouch) sceneChanges(scene Scene) (ACChange, []GroupChange, []Drift, error) {
+	err := a.GetGroupData()
+	if err != nil {
+		return ACChange{}, nil, nil, err
+	}
+
+	err = a.GetACData()
+	if err != nil {
+		return ACChange{}, nil, nil, err
+	}
+
+	r := Reconciler{AirTouch: a}
+	desired := scene.DesiredState()
+
+	acChange, drift := r.acDrift(desired)
+
+	var groupChanges []GroupChange
+	for _, want := range desired.Groups {
+		number, _ := strconv.Atoi(want.Group)
+		if a.groupByNumber(number) == nil {
+			return ACChange{}, nil, nil, &ValidationError{Field: "Group", Value: want.Group, Reason: "not on the console"}
+		}
+
+		change, groupDrift := r.groupDrift(number, want)
+		drift = append(drift, groupDrift...)
+
+		if change != (GroupChange{Group: want.Group}) {
+			groupChanges = append(groupChanges, change)
+		}
+	}
+
+	return acChange, groupChanges, drift, nil
+}
+
+// validateSceneName checks a scene name can be stored as a file.
+func validateSceneName(name string) error {
+	if !sceneNamePattern.MatchString(name) {
+		return &ValidationError{Field: "Scene", Value: name, Reason: "names use letters, numbers, spaces, - and _"}
+	}
+
+	return nil
+}
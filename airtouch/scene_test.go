@@ -0,0 +1,173 @@
+package airtouch
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSceneStore(t *testing.T) {
+	a := &AirTouch{RootTempDir: t.TempDir()}
+
+	if names, err := a.Scenes(); err != nil || len(names) != 0 {
+		t.Fatalf("expected no scenes, got %v, %v", names, err)
+	}
+
+	scene := Scene{
+		Name:   "Movie night",
+		AC:     SceneAC{Power: "On", Mode: "Cool", FanSpeed: "Quiet", TargetSetpoint: 23},
+		Groups: []SceneGroup{{Number: 0, Name: "Living", Power: "On", ControlMethod: "TemperatureControl", TargetSetpoint: 22}},
+	}
+
+	for _, name := range []string{"Movie night", "away_cool"} {
+		scene.Name = name
+		if err := a.SaveScene(scene); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loaded, err := a.LoadScene("Movie night")
+	if err != nil || loaded.AC != (SceneAC{Power: "On", Mode: "Cool", FanSpeed: "Quiet", TargetSetpoint: 23}) || len(loaded.Groups) != 1 || loaded.Groups[0] != scene.Groups[0] {
+		t.Errorf("expected the scene to round trip, got %+v, %v", loaded, err)
+	}
+
+	if names, err := a.Scenes(); err != nil || len(names) != 2 || names[0] != "Movie night" || names[1] != "away_cool" {
+		t.Errorf("expected both scenes, got %v, %v", names, err)
+	}
+
+	var validationErr *ValidationError
+	if err := a.SaveScene(Scene{Name: "../escape"}); !errors.As(err, &validationErr) {
+		t.Errorf("expected a ValidationError for a path in the name, got %v", err)
+	}
+
+	if err := a.DeleteScene("away_cool"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.LoadScene("away_cool"); err == nil {
+		t.Error("expected the deleted scene to be gone")
+	}
+}
+
+func TestApplyScene(t *testing.T) {
+	var acControls, groupControls [][]byte
+	a := fakeConsole(t, func(request []byte) []byte {
+		switch request[5] {
+		case 0x1f:
+			return replyFrame(0x1f, groupNameSeed)
+		case 0x2a:
+			groupControls = append(groupControls, request)
+			return groupStatusReply
+		case 0x2b:
+			return groupStatusReply
+		case 0x2c:
+			acControls = append(acControls, request)
+			return acStatusReply
+		default:
+			return acStatusReply
+		}
+	})
+	a.Confirmation = ConfirmNone
+
+	scene, err := a.CaptureScene("Evening")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scene.AC != (SceneAC{Power: "On", Mode: "Cool", FanSpeed: "Low", TargetSetpoint: 22}) || len(scene.Groups) != 2 || scene.Groups[0].Name != "Living" {
+		t.Fatalf("expected the live configuration, got %+v", scene)
+	}
+
+	// Restoring the scene the console is already in sends nothing.
+	drift, err := a.ApplyScene(scene)
+	if err != nil || len(drift) != 0 || len(acControls)+len(groupControls) != 0 {
+		t.Fatalf("expected no changes, got %+v, %d frames, %v", drift, len(acControls)+len(groupControls), err)
+	}
+
+	scene.AC.FanSpeed = "High"
+	scene.AC.TargetSetpoint = 24
+	scene.Groups[0].TargetSetpoint = 21
+
+	drift, err = a.PreviewScene(scene)
+	if err != nil || len(drift) != 3 || len(acControls)+len(groupControls) != 0 {
+		t.Fatalf("expected a preview of three changes without sending, got %+v, %v", drift, err)
+	}
+
+	if drift[0].Field != "AcFanSpeed" || drift[0].Actual != "Low" || drift[2].Target != "0" || drift[2].Desired != "21" {
+		t.Errorf("unexpected preview %+v", drift)
+	}
+
+	if _, err := a.ApplyScene(scene); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(acControls) != 1 || len(groupControls) != 1 {
+		t.Fatalf("expected one AC and one group frame, got %d and %d", len(acControls), len(groupControls))
+	}
+
+	// Power and mode are kept, only the fan speed and setpoint are sent.
+	ac := acControls[0][8:]
+	if ac[0]>>6 != 0 || ac[1]>>4 != 15 || ac[1]&0x0f != 4 || ac[2]&0x3f != 24 {
+		t.Errorf("expected a minimal AC frame, got %x", ac)
+	}
+
+	// Only group 0 is sent.
+	if groupControls[0][7] != 4 || groupControls[0][8] != 0 {
+		t.Errorf("expected a single group in the group frame, got %x", groupControls[0])
+	}
+
+	// Nothing is sent when any change is invalid.
+	scene.Groups[1].ControlMethod = "TemperatureControl"
+	scene.Groups[1].TargetSetpoint = 99
+
+	var validationErr *ValidationError
+	if _, err := a.ApplyScene(scene); !errors.As(err, &validationErr) || len(acControls) != 1 || len(groupControls) != 1 {
+		t.Errorf("expected a ValidationError without sending, got %v", err)
+	}
+}
+
+func TestApplySceneReverts(t *testing.T) {
+	var acControls, groupControls int
+	a := fakeConsole(t, func(request []byte) []byte {
+		switch request[5] {
+		case 0x1f:
+			return replyFrame(0x1f, groupNameSeed)
+		case 0x2a:
+			// The console ignores every group change.
+			groupControls++
+			return groupStatusReply
+		case 0x2b:
+			return groupStatusReply
+		case 0x2c:
+			acControls++
+			if acControls == 1 {
+				return replyFrame(ACStatusType, []byte{0x40, 0x44, 0x18, 0x00, 0x5b, 0x60, 0x00, 0x00})
+			}
+			return acStatusReply
+		default:
+			return acStatusReply
+		}
+	})
+
+	scene, err := a.CaptureScene("Evening")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scene.AC.FanSpeed = "High"
+	scene.AC.TargetSetpoint = 24
+	scene.Groups[0].TargetSetpoint = 21
+
+	_, err = a.ApplyScene(scene)
+	if !errors.Is(err, ErrRejected) {
+		t.Fatalf("expected the rejected group change, got %v", err)
+	}
+
+	// The AC change that was applied is reverted.
+	if acControls != 2 || groupControls != 2 {
+		t.Errorf("expected the AC and groups to be reverted, got %d AC and %d group frames", acControls, groupControls)
+	}
+
+	if a.AC.AcFanSpeed != "Low" || a.AC.AcTargetSetpoint != 22 {
+		t.Errorf("expected the AC to be back as it was, got %+v", a.AC)
+	}
+}
@@ -0,0 +1,572 @@
+package airtouch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScheduleTargetAC is the Program target for the AC.
+const ScheduleTargetAC = "AC"
+
+// ScheduleEntry changes a target at a time of day. Empty fields are left alone.
+type ScheduleEntry struct {
+	// Days the entry runs on. Empty runs every day.
+	Days []time.Weekday
+	// At is the local time as 15:04. Times skipped when the clocks go forward run that much later.
+	At string
+	// Solar runs the entry at a SolarEventMap event plus Offset in place of At. Days without the
+	// event, such as polar summers, are skipped.
+	Solar  string
+	Offset time.Duration
+	// Power is On or Off, or for groups Turbo.
+	Power string
+	// Mode is an ACModeMap mode. AC only.
+	Mode string
+	// TargetSetpoint is in degrees, as on GroupChange for groups and ACChange for the AC.
+	TargetSetpoint string
+	// OpenPercentage is as on GroupChange. Groups only.
+	OpenPercentage string
+}
+
+// Program is the weekly schedule of the AC or a group.
+type Program struct {
+	// Target is ScheduleTargetAC or a group number, name or alias.
+	Target  string
+	Entries []ScheduleEntry
+}
+
+// Hold is a manual change that overrides a program until its next scheduled entry.
+type Hold struct {
+	Target string
+	Entry  ScheduleEntry
+	Until  time.Time
+}
+
+// Scheduler applies weekly programs in Timezone. Each entry is applied once, when its time
+// arrives, so changes made in between are left alone until the next entry.
+type Scheduler struct {
+	AirTouch *AirTouch
+	// Interval is how often Run checks the programs. Defaults to a minute.
+	Interval time.Duration
+	// Calendars are ICS files whose events apply the presets. While an event is on, its preset
+	// takes the place of the weekly programs of the targets it changes. When it ends, their
+	// programs' current entries are applied again.
+	Calendars []string
+
+	mu       sync.Mutex
+	programs []Program
+	presets  []Preset
+	applied  map[string]time.Time
+	events   map[string]string
+	holds    map[string]Hold
+	now      func() time.Time
+}
+
+// SetPrograms validates and replaces the programs. Targets whose program changed have their
+// current entry applied on the next tick.
+func (s *Scheduler) SetPrograms(programs []Program) error {
+	for _, program := range programs {
+		for _, entry := range program.Entries {
+			err := s.AirTouch.validateScheduleEntry(program.Target, entry)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := programEntries(s.programs)
+	for key, entries := range programEntries(programs) {
+		if !reflect.DeepEqual(old[key], entries) {
+			delete(s.applied, key)
+		}
+		delete(old, key)
+	}
+
+	// Targets that no longer have a program start afresh if they get one again.
+	for key := range old {
+		delete(s.applied, key)
+	}
+
+	s.programs = programs
+
+	return nil
+}
+
+// programEntries returns the entries of programs by lower case target.
+func programEntries(programs []Program) map[string][]ScheduleEntry {
+	entries := make(map[string][]ScheduleEntry)
+	for _, program := range programs {
+		key := strings.ToLower(program.Target)
+		entries[key] = append(entries[key], program.Entries...)
+	}
+
+	return entries
+}
+
+// Hold applies entry to target now and suspends its program and calendar presets until the next
+// scheduled entry or the next start or end of an event that changes it, whichever is first.
+// target must be written as it is in the program. The entry's times and Days are ignored. Targets
+// that nothing is scheduled for within a week can't be held.
+func (s *Scheduler) Hold(target string, entry ScheduleEntry) error {
+	check := entry
+	check.At = "00:00"
+	check.Solar = ""
+	check.Offset = 0
+
+	err := s.AirTouch.validateScheduleEntry(target, check)
+	if err != nil {
+		return err
+	}
+
+	loc := s.AirTouch.location()
+	now := s.clock()
+
+	var until time.Time
+	for _, program := range s.programsFor(target) {
+		next, ok := s.AirTouch.nextEntry(program, now, loc)
+		if ok && (until.IsZero() || next.Before(until)) {
+			until = next
+		}
+	}
+
+	boundary, ok := s.calendarBoundary(target, now, loc)
+	if ok && (until.IsZero() || boundary.Before(until)) {
+		until = boundary
+	}
+
+	if until.IsZero() {
+		return &ValidationError{Field: "Hold", Value: target, Reason: "no scheduled entry or calendar event ends the hold"}
+	}
+
+	err = s.send(target, entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.holds == nil {
+		s.holds = make(map[string]Hold)
+	}
+
+	s.holds[strings.ToLower(target)] = Hold{Target: target, Entry: entry, Until: until}
+	s.AirTouch.logger().Info("holding schedule", "target", target, "until", until)
+
+	return nil
+}
+
+// ClearHold ends a hold early. The current calendar preset or program entry is applied on the next
+// tick.
+func (s *Scheduler) ClearHold(target string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.holds, strings.ToLower(target))
+	delete(s.applied, strings.ToLower(target))
+	delete(s.events, strings.ToLower(target))
+}
+
+// Holds returns the holds in place.
+func (s *Scheduler) Holds() []Hold {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var holds []Hold
+	for _, hold := range s.holds {
+		holds = append(holds, hold)
+	}
+
+	return holds
+}
+
+// Run checks the programs every Interval until ctx is cancelled. Errors are logged rather than
+// returned.
+func (s *Scheduler) Run(ctx context.Context) error {
+	interval := s.Interval
+	if interval == 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := s.Tick()
+		if err != nil {
+			s.AirTouch.logger().Warn("schedule failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick applies the presets of calendar events that have started, then the latest entry of each
+// program if it hasn't been applied yet and the target isn't held. Holds end at the next entry.
+func (s *Scheduler) Tick() error {
+	loc := s.AirTouch.location()
+	now := s.clock()
+
+	var errs []error
+
+	changes, err := s.calendarChanges(now, loc)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	s.mu.Lock()
+	programs := append([]Program(nil), s.programs...)
+
+	// Targets whose event has ended go back to their program.
+	for key := range s.events {
+		if _, ok := changes[key]; !ok {
+			delete(s.events, key)
+			delete(s.applied, key)
+		}
+	}
+	s.mu.Unlock()
+
+	keys := make([]string, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		change := changes[key]
+
+		s.mu.Lock()
+		applied := s.held(key, now) || s.events[key] == change.Instance
+		s.mu.Unlock()
+
+		if applied {
+			continue
+		}
+
+		s.AirTouch.logger().Info("applying calendar preset", "target", change.Target, "event", change.Event, "entry", change.Entry)
+
+		err := s.apply(change.Target, change.Entry)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		s.mu.Lock()
+		if s.events == nil {
+			s.events = make(map[string]string)
+		}
+		s.events[key] = change.Instance
+		s.mu.Unlock()
+	}
+
+	for _, program := range programs {
+		key := strings.ToLower(program.Target)
+
+		if _, ok := changes[key]; ok {
+			continue
+		}
+
+		at, entry, ok := s.AirTouch.currentEntry(program, now, loc)
+		if !ok {
+			continue
+		}
+
+		s.mu.Lock()
+		applied := s.held(key, now) || s.applied[key].Equal(at)
+		s.mu.Unlock()
+
+		if applied {
+			continue
+		}
+
+		s.AirTouch.logger().Info("applying schedule", "target", program.Target, "at", at, "entry", entry)
+
+		err := s.apply(program.Target, entry)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		s.mu.Lock()
+		if s.applied == nil {
+			s.applied = make(map[string]time.Time)
+		}
+		s.applied[key] = at
+		s.mu.Unlock()
+	}
+
+	return errors.Join(errs...)
+}
+
+// held returns true if a target is held, removing the hold once it has ended. s.mu must be held.
+func (s *Scheduler) held(key string, now time.Time) bool {
+	hold, ok := s.holds[key]
+	if ok && now.Before(hold.Until) {
+		return true
+	}
+
+	delete(s.holds, key)
+
+	return false
+}
+
+// apply sends an entry to its target unless it is paused after a manual change, so the change
+// stands until the target's next entry.
+func (s *Scheduler) apply(target string, entry ScheduleEntry) error {
+	if pause, ok := s.AirTouch.Paused(target); ok {
+		s.AirTouch.logger().Info("target changed manually, skipping schedule", "target", target, "until", pause.Until)
+		return nil
+	}
+
+	return s.send(target, entry)
+}
+
+// send sends an entry to its target. Fields that are not set are kept as they are.
+func (s *Scheduler) send(target string, entry ScheduleEntry) error {
+	a := s.AirTouch
+
+	if !strings.EqualFold(target, ScheduleTargetAC) {
+		return a.SetGroups([]GroupChange{{
+			Group:          target,
+			Power:          entry.Power,
+			TargetSetpoint: entry.TargetSetpoint,
+			OpenPercentage: entry.OpenPercentage,
+		}})
+	}
+
+	change := ACChange{Power: entry.Power, Mode: entry.Mode, TargetSetpoint: entry.TargetSetpoint}
+	if change == (ACChange{}) {
+		return nil
+	}
+
+	// The compressor guard and setpoint range need the current power and mode.
+	if entry.Power == "" || entry.Mode == "" {
+		err := a.GetACData()
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.SetAC(change)
+}
+
+// programsFor returns the programs of a target.
+func (s *Scheduler) programsFor(target string) []Program {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var programs []Program
+	for _, program := range s.programs {
+		if strings.EqualFold(program.Target, target) {
+			programs = append(programs, program)
+		}
+	}
+
+	return programs
+}
+
+// clock returns the current time.
+func (s *Scheduler) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+
+	return time.Now()
+}
+
+// occurrences returns when each entry of a program runs on the days from a week before to a week
+// after now.
+func (a *AirTouch) occurrences(program Program, now time.Time, loc *time.Location) ([]time.Time, []ScheduleEntry) {
+	var times []time.Time
+	var entries []ScheduleEntry
+
+	local := now.In(loc)
+
+	for offset := -7; offset <= 7; offset++ {
+		// Days are stepped with time.Date rather than by adding 24 hours so that DST changes
+		// don't shift them.
+		day := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, loc)
+
+		for _, entry := range program.Entries {
+			if !runsOn(entry, day.Weekday()) {
+				continue
+			}
+
+			at, ok := a.entryTime(entry, day, loc)
+			if !ok {
+				continue
+			}
+
+			times = append(times, at)
+			entries = append(entries, entry)
+		}
+	}
+
+	return times, entries
+}
+
+// currentEntry returns the entry that most recently ran.
+func (a *AirTouch) currentEntry(program Program, now time.Time, loc *time.Location) (time.Time, ScheduleEntry, bool) {
+	times, entries := a.occurrences(program, now, loc)
+
+	var latest time.Time
+	var current ScheduleEntry
+	found := false
+
+	for i, at := range times {
+		if !at.After(now) && (!found || at.After(latest)) {
+			latest, current, found = at, entries[i], true
+		}
+	}
+
+	return latest, current, found
+}
+
+// nextEntry returns when the next entry runs.
+func (a *AirTouch) nextEntry(program Program, now time.Time, loc *time.Location) (time.Time, bool) {
+	times, _ := a.occurrences(program, now, loc)
+
+	var next time.Time
+	found := false
+
+	for _, at := range times {
+		if at.After(now) && (!found || at.Before(next)) {
+			next, found = at, true
+		}
+	}
+
+	return next, found
+}
+
+// entryTime returns when an entry runs on a local day.
+func (a *AirTouch) entryTime(entry ScheduleEntry, day time.Time, loc *time.Location) (time.Time, bool) {
+	if entry.Solar != "" {
+		at, ok := a.SolarTime(entry.Solar, day)
+		return at.Add(entry.Offset).In(loc), ok
+	}
+
+	at, _ := time.Parse("15:04", entry.At)
+
+	return time.Date(day.Year(), day.Month(), day.Day(), at.Hour(), at.Minute(), 0, 0, loc), true
+}
+
+// runsOn returns true if an entry runs on a weekday.
+func runsOn(entry ScheduleEntry, weekday time.Weekday) bool {
+	if len(entry.Days) == 0 {
+		return true
+	}
+
+	for _, day := range entry.Days {
+		if day == weekday {
+			return true
+		}
+	}
+
+	return false
+}
+
+// location returns Timezone, falling back to UTC if it can't be loaded.
+func (a *AirTouch) location() *time.Location {
+	loc, err := time.LoadLocation(a.Timezone)
+	if err != nil {
+		a.logger().Warn("unable to load timezone, using UTC", "timezone", a.Timezone, "error", err)
+		return time.UTC
+	}
+
+	return loc
+}
+
+// validateScheduleEntry checks an entry can be applied to its target.
+func (a *AirTouch) validateScheduleEntry(target string, entry ScheduleEntry) error {
+	err := a.validateEntryTime(entry)
+	if err != nil {
+		return err
+	}
+
+	for _, day := range entry.Days {
+		if day < time.Sunday || day > time.Saturday {
+			return &ValidationError{Field: "Days", Value: day.String(), Reason: "not a weekday"}
+		}
+	}
+
+	if strings.EqualFold(target, ScheduleTargetAC) {
+		if _, ok := a.ACPowerMap()[entry.Power]; entry.Power != "" && !ok {
+			return &ValidationError{Field: "Power", Value: entry.Power, Reason: "unknown power state"}
+		}
+
+		if _, ok := a.ACModeMap()[entry.Mode]; entry.Mode != "" && !ok {
+			return &ValidationError{Field: "Mode", Value: entry.Mode, Reason: "unknown mode"}
+		}
+
+		if _, err := strconv.Atoi(entry.TargetSetpoint); entry.TargetSetpoint != "" && err != nil {
+			return &ValidationError{Field: "TargetSetpoint", Value: entry.TargetSetpoint, Reason: "not a number"}
+		}
+
+		if entry.OpenPercentage != "" {
+			return &ValidationError{Field: "OpenPercentage", Value: entry.OpenPercentage, Reason: "percentages are set on groups"}
+		}
+
+		return nil
+	}
+
+	if entry.Mode != "" {
+		return &ValidationError{Field: "Mode", Value: entry.Mode, Reason: "modes are set on the AC"}
+	}
+
+	if _, ok := a.GroupPowerMap()[entry.Power]; entry.Power != "" && !ok {
+		return &ValidationError{Field: "Power", Value: entry.Power, Reason: "unknown power state"}
+	}
+
+	if entry.TargetSetpoint != "" && entry.OpenPercentage != "" {
+		return &ValidationError{Field: "TargetSetpoint", Value: entry.TargetSetpoint, Reason: "cannot be set with OpenPercentage"}
+	}
+
+	return nil
+}
+
+// validateEntryTime checks an entry runs at a 15:04 time or a solar event at a known place.
+func (a *AirTouch) validateEntryTime(entry ScheduleEntry) error {
+	if entry.Solar == "" {
+		if entry.Offset != 0 {
+			return &ValidationError{Field: "Offset", Value: entry.Offset.String(), Reason: "offsets are relative to a solar event"}
+		}
+
+		if _, err := time.Parse("15:04", entry.At); err != nil {
+			return &ValidationError{Field: "At", Value: entry.At, Reason: "not a 15:04 time"}
+		}
+
+		return nil
+	}
+
+	if !a.SolarEventMap()[entry.Solar] {
+		return &ValidationError{Field: "Solar", Value: entry.Solar, Reason: "unknown solar event"}
+	}
+
+	if entry.At != "" {
+		return &ValidationError{Field: "At", Value: entry.At, Reason: "cannot be set with Solar"}
+	}
+
+	if a.Latitude == 0 && a.Longitude == 0 {
+		return &ValidationError{Field: "Latitude", Value: "0", Reason: "latitude and longitude must be set for solar entries"}
+	}
+
+	if a.Latitude < -90 || a.Latitude > 90 || a.Longitude < -180 || a.Longitude > 180 {
+		return &ValidationError{Field: "Latitude", Value: fmt.Sprintf("%v,%v", a.Latitude, a.Longitude), Reason: "not a latitude and longitude"}
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package airtouch
+
+import (
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestScheduler(t *testing.T) {
+	var controls [][]byte
+	a := fakeConsole(t, func(request []byte) []byte {
+		switch request[5] {
+		case 0x2a:
+			controls = append(controls, request)
+			return groupStatusReply
+		case 0x2c:
+			controls = append(controls, request)
+		case 0x2b:
+			return groupStatusReply
+		}
+		return acStatusReply
+	})
+	a.Confirmation = ConfirmNone
+	a.Timezone = "Australia/Sydney"
+
+	loc, _ := time.LoadLocation(a.Timezone)
+	now := time.Date(2024, 7, 1, 6, 0, 0, 0, loc) // A Monday.
+	s := Scheduler{AirTouch: a, now: func() time.Time { return now }}
+
+	weekdays := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	err := s.SetPrograms([]Program{
+		{Target: "0", Entries: []ScheduleEntry{
+			{Days: weekdays, At: "07:00", Power: "On", TargetSetpoint: "22"},
+			{At: "22:00", Power: "Off"},
+		}},
+		{Target: ScheduleTargetAC, Entries: []ScheduleEntry{
+			{At: "06:30", Mode: "Heat"},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		at       string
+		controls int
+	}{
+		{"06:00", 2}, // Sunday's 22:00 Off and 06:30 Heat are applied on start.
+		{"06:15", 2},
+		{"06:45", 3}, // Monday's 06:30 Heat.
+		{"07:05", 4},
+	}
+
+	for _, step := range steps {
+		clock, _ := time.Parse("15:04", step.at)
+		now = time.Date(2024, 7, 1, clock.Hour(), clock.Minute(), 0, 0, loc)
+
+		if err := s.Tick(); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(controls) != step.controls {
+			t.Errorf("%s: expected %d control messages, got %d", step.at, step.controls, len(controls))
+		}
+	}
+
+	// A hold lasts until the next entry.
+	now = time.Date(2024, 7, 1, 8, 0, 0, 0, loc)
+	if err := s.Hold("0", ScheduleEntry{Power: "Off"}); err != nil {
+		t.Fatal(err)
+	}
+
+	holds := s.Holds()
+	if len(holds) != 1 || !holds[0].Until.Equal(time.Date(2024, 7, 1, 22, 0, 0, 0, loc)) {
+		t.Errorf("expected a hold until 22:00, got %+v", holds)
+	}
+
+	// Clearing a hold, even where there is none, applies the current entry again.
+	s.ClearHold("AC")
+	now = time.Date(2024, 7, 1, 21, 0, 0, 0, loc)
+	if err := s.Tick(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(controls) != 6 {
+		t.Errorf("expected the hold and the AC entry to be sent, got %d control messages", len(controls))
+	}
+
+	now = time.Date(2024, 7, 1, 22, 1, 0, 0, loc)
+	if err := s.Tick(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(controls) != 7 || len(s.Holds()) != 0 {
+		t.Errorf("expected the program to resume at 22:00, got %d control messages and holds %+v", len(controls), s.Holds())
+	}
+	// Only the program that changed has its current entry applied again.
+	err = s.SetPrograms([]Program{
+		{Target: "0", Entries: []ScheduleEntry{
+			{Days: weekdays, At: "07:00", Power: "On", TargetSetpoint: "22"},
+			{At: "22:00", Power: "Off"},
+		}},
+		{Target: ScheduleTargetAC, Entries: []ScheduleEntry{
+			{At: "06:30", Mode: "Heat", TargetSetpoint: "23"},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Tick(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(controls) != 8 || controls[7][5] != 0x2c || controls[7][10]&0x3f != 23 {
+		t.Errorf("expected only the AC entry with its setpoint to be sent, got %d control messages", len(controls))
+	}
+}
+
+func TestScheduleDST(t *testing.T) {
+	a := &AirTouch{}
+	loc, err := time.LoadLocation("Australia/Sydney")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	program := Program{Target: "0", Entries: []ScheduleEntry{
+		{At: "02:30", Power: "On"},
+		{At: "07:00", Power: "Off"},
+	}}
+
+	// The clocks go forward from 02:00 to 03:00 on 6 October 2024, so 02:30 doesn't happen.
+	next, _ := a.nextEntry(program, time.Date(2024, 10, 6, 1, 0, 0, 0, loc), loc)
+	if expected := time.Date(2024, 10, 6, 3, 30, 0, 0, loc); !next.Equal(expected) {
+		t.Errorf("expected the skipped entry at %v, got %v", expected, next)
+	}
+
+	// Entries after the change keep their wall clock time.
+	next, _ = a.nextEntry(program, time.Date(2024, 10, 6, 4, 0, 0, 0, loc), loc)
+	if next.In(loc).Hour() != 7 || next.Sub(time.Date(2024, 10, 6, 4, 0, 0, 0, loc)) != 3*time.Hour {
+		t.Errorf("expected 07:00 local, got %v", next.In(loc))
+	}
+
+	// The clocks go back from 03:00 to 02:00 on 7 April 2024, so 02:30 happens twice but runs once.
+	times, _ := a.occurrences(program, time.Date(2024, 4, 7, 12, 0, 0, 0, loc), loc)
+	count := 0
+	for _, at := range times {
+		local := at.In(loc)
+		if local.Month() == time.April && local.Day() == 7 && local.Hour() == 2 {
+			count++
+		}
+	}
+
+	if count != 1 {
+		t.Errorf("expected 02:30 to run once on 7 April, got %d", count)
+	}
+}
+
+func TestScheduleValidation(t *testing.T) {
+	s := Scheduler{AirTouch: &AirTouch{}}
+
+	for _, program := range []Program{
+		{Target: "0", Entries: []ScheduleEntry{{At: "7am"}}},
+		{Target: "0", Entries: []ScheduleEntry{{At: "07:00", Mode: "Cool"}}},
+		{Target: "0", Entries: []ScheduleEntry{{At: "07:00", TargetSetpoint: "22", OpenPercentage: "50"}}},
+		{Target: "AC", Entries: []ScheduleEntry{{At: "07:00", OpenPercentage: "50"}}},
+		{Target: "AC", Entries: []ScheduleEntry{{At: "07:00", TargetSetpoint: "warm"}}},
+		{Target: "AC", Entries: []ScheduleEntry{{At: "07:00", Mode: "Warm"}}},
+	} {
+		if err := s.SetPrograms([]Program{program}); !errors.Is(err, ErrValidation) {
+			t.Errorf("%+v: expected ErrValidation, got %v", program, err)
+		}
+	}
+}
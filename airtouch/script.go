@@ -0,0 +1,560 @@
+package airtouch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkjson"
+)
+
+const (
+	// scriptHistory is how many events ScriptEngine keeps for history().
+	scriptHistory = 1000
+	// scriptHistoryFile is where the events are kept in RootTempDir across restarts.
+	scriptHistoryFile = "script_history.json"
+	// scriptActivity is the type history() gives the group activity GenerateGroupStatistics records.
+	scriptActivity = "GroupActivity"
+)
+
+// ScriptStatus describes the last run of a script.
+type ScriptStatus struct {
+	Name         string
+	Runs         int
+	LastRun      time.Time
+	LastDuration time.Duration
+	LastError    string
+}
+
+// ScriptEngine runs Starlark scripts from Dir. A script defines on_event(event), on_timer() or
+// both. INTERVAL sets how many seconds apart on_timer runs and EVENTS limits on_event to a list of
+// event types. Scripts can't load modules or reach the filesystem or network; they see the
+// console through these builtins:
+//
+//	snapshot()                               the current Snapshot as a dict
+//	history(type="", group="", since=0)      past events and today's GroupActivity, optionally filtered, since seconds ago
+//	now()                                    a dict of year, month, day, hour, minute, weekday and unix in Timezone
+//	set_ac(power, mode)                      SetACState, skipped while the AC is Paused
+//	set_group(group, power="", setpoint="", percentage="")  SetGroups with a single change, skipped while the group is Paused
+//	log(msg)                                 logs msg with the script name
+//
+// history() returns the last events the engine handled, kept in RootTempDir so they survive
+// restarts, along with the On and Off records GenerateGroupStatistics made for each group today.
+type ScriptEngine struct {
+	AirTouch *AirTouch
+	// Dir holds the *.star scripts.
+	Dir string
+	// Interval is how often Run refreshes the state and checks timers, and the timer interval of
+	// scripts without INTERVAL. Defaults to a minute.
+	Interval time.Duration
+	// Budget is how long a single run of a script may take before it is cancelled. Defaults to a
+	// second. Scripts are cancelled between steps, so a set_ac or set_group call that is running
+	// when the budget is spent finishes first. Each message it sends can take up to the console's
+	// 5 second timeout, and confirmation polls add more.
+	Budget time.Duration
+
+	mu            sync.Mutex
+	scripts       []*script
+	history       []Event
+	historyLoaded bool
+	now           func() time.Time
+}
+
+// script is a loaded script and its status.
+type script struct {
+	name      string
+	globals   starlark.StringDict
+	interval  time.Duration
+	events    []string
+	lastTimer time.Time
+	status    ScriptStatus
+}
+
+// Load reads every script in Dir, replacing those already loaded. A script that fails to load
+// is skipped and its error returned along with any others.
+func (e *ScriptEngine) Load() error {
+	paths, err := filepath.Glob(filepath.Join(e.Dir, "*.star"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	var scripts []*script
+	var errs []error
+
+	for _, path := range paths {
+		s, err := e.load(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		scripts = append(scripts, s)
+	}
+
+	e.mu.Lock()
+	e.scripts = scripts
+	e.mu.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// load executes a script's top level and reads its settings.
+func (e *ScriptEngine) load(path string) (*script, error) {
+	name := strings.TrimSuffix(filepath.Base(path), ".star")
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &script{name: name, interval: e.interval(), status: ScriptStatus{Name: name}}
+
+	thread := e.thread(s)
+	stop := e.budget(thread)
+	globals, err := starlark.ExecFile(thread, path, src, e.builtins(s))
+	stop()
+	if err != nil {
+		return nil, &ValidationError{Field: "Script", Value: name, Reason: err.Error()}
+	}
+
+	if globals["on_event"] == nil && globals["on_timer"] == nil {
+		return nil, &ValidationError{Field: "Script", Value: name, Reason: "defines neither on_event nor on_timer"}
+	}
+
+	if interval, ok := globals["INTERVAL"].(starlark.Int); ok {
+		seconds, ok := interval.Int64()
+		if !ok || seconds <= 0 {
+			return nil, &ValidationError{Field: "Script", Value: name, Reason: "INTERVAL must be a positive number of seconds"}
+		}
+		s.interval = time.Duration(seconds) * time.Second
+	}
+
+	if events, ok := globals["EVENTS"].(*starlark.List); ok {
+		for i := 0; i < events.Len(); i++ {
+			event, ok := starlark.AsString(events.Index(i))
+			if !ok {
+				return nil, &ValidationError{Field: "Script", Value: name, Reason: "EVENTS must be event type strings"}
+			}
+			s.events = append(s.events, event)
+		}
+	}
+
+	s.globals = globals
+	e.AirTouch.logger().Info("loaded script", "script", name, "interval", s.interval, "events", s.events)
+
+	return s, nil
+}
+
+// Status returns the status of every loaded script.
+func (e *ScriptEngine) Status() []ScriptStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var status []ScriptStatus
+	for _, s := range e.scripts {
+		status = append(status, s.status)
+	}
+
+	return status
+}
+
+// Run refreshes the state and runs due timers every Interval, and runs on_event as events arrive,
+// until ctx is cancelled. Errors are logged rather than returned.
+func (e *ScriptEngine) Run(ctx context.Context) error {
+	// Events are queued so that scripts whose control calls cause events don't run re-entrantly.
+	events := make(chan Event, 64)
+	unsubscribe := e.AirTouch.Subscribe(func(event Event) {
+		select {
+		case events <- event:
+		default:
+			e.AirTouch.logger().Warn("script engine busy, dropping event", "event", event.Type)
+		}
+	})
+	defer unsubscribe()
+
+	ticker := time.NewTicker(e.interval())
+	defer ticker.Stop()
+
+	err := e.Tick()
+	if err != nil {
+		e.AirTouch.logger().Warn("script engine tick failed", "error", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event := <-events:
+			err := e.HandleEvent(event)
+			if err != nil {
+				e.AirTouch.logger().Warn("script engine event failed", "event", event.Type, "error", err)
+			}
+		case <-ticker.C:
+			err := e.Tick()
+			if err != nil {
+				e.AirTouch.logger().Warn("script engine tick failed", "error", err)
+			}
+		}
+	}
+}
+
+// Tick refreshes the group and AC data and runs on_timer for scripts whose interval has passed.
+func (e *ScriptEngine) Tick() error {
+	err := e.AirTouch.GetGroupData()
+	if err != nil {
+		return err
+	}
+
+	err = e.AirTouch.GetACData()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, s := range e.loaded() {
+		if s.globals["on_timer"] == nil || e.clock().Before(s.lastTimer.Add(s.interval)) {
+			continue
+		}
+
+		s.lastTimer = e.clock()
+		errs = append(errs, e.call(s, "on_timer"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// HandleEvent records an event for history() and runs on_event for scripts listening for it.
+func (e *ScriptEngine) HandleEvent(event Event) error {
+	e.mu.Lock()
+	e.loadHistory()
+	e.history = append(e.history, event)
+	if len(e.history) > scriptHistory {
+		e.history = e.history[len(e.history)-scriptHistory:]
+	}
+	e.saveHistory()
+	e.mu.Unlock()
+
+	var errs []error
+
+	for _, s := range e.loaded() {
+		if s.globals["on_event"] == nil || !listensFor(Trigger{Events: s.events}, event.Type) {
+			continue
+		}
+
+		value, err := toStarlark(eventJSON(event))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("script %s: %w", s.name, err))
+			continue
+		}
+
+		errs = append(errs, e.call(s, "on_event", value))
+	}
+
+	return errors.Join(errs...)
+}
+
+// loaded returns the loaded scripts.
+func (e *ScriptEngine) loaded() []*script {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]*script(nil), e.scripts...)
+}
+
+// call runs a script function within the budget and records the run.
+func (e *ScriptEngine) call(s *script, function string, args ...starlark.Value) error {
+	log := e.AirTouch.logger().With("script", s.name)
+	start := e.clock()
+
+	thread := e.thread(s)
+	stop := e.budget(thread)
+	_, err := starlark.Call(thread, s.globals[function], args, nil)
+	stop()
+
+	e.mu.Lock()
+	s.status.Runs++
+	s.status.LastRun = start
+	s.status.LastDuration = e.clock().Sub(start)
+	s.status.LastError = ""
+	if err != nil {
+		s.status.LastError = err.Error()
+	}
+	e.mu.Unlock()
+
+	if err != nil {
+		log.Warn("script failed", "function", function, "error", err)
+		return fmt.Errorf("script %s: %w", s.name, err)
+	}
+
+	log.Debug("script ran", "function", function, "duration", s.status.LastDuration)
+
+	return nil
+}
+
+// thread returns a sandboxed thread that logs prints under the script name.
+func (e *ScriptEngine) thread(s *script) *starlark.Thread {
+	log := e.AirTouch.logger().With("script", s.name)
+
+	return &starlark.Thread{
+		Name: s.name,
+		Print: func(_ *starlark.Thread, msg string) {
+			log.Info(msg)
+		},
+	}
+}
+
+// budget cancels the thread once the run-time budget is spent. The returned function stops the
+// timer.
+func (e *ScriptEngine) budget(thread *starlark.Thread) func() {
+	budget := e.Budget
+	if budget == 0 {
+		budget = time.Second
+	}
+
+	timer := time.AfterFunc(budget, func() {
+		thread.Cancel(fmt.Sprintf("run-time budget of %s exceeded", budget))
+	})
+
+	return func() { timer.Stop() }
+}
+
+// builtins are the functions scripts call to see and change the console.
+func (e *ScriptEngine) builtins(s *script) starlark.StringDict {
+	a := e.AirTouch
+	log := a.logger().With("script", s.name)
+
+	return starlark.StringDict{
+		"snapshot": starlark.NewBuiltin("snapshot", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+				return nil, err
+			}
+			return toStarlark(a.Snapshot())
+		}),
+		"history": starlark.NewBuiltin("history", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var eventType, group string
+			var since int
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "type?", &eventType, "group?", &group, "since?", &since); err != nil {
+				return nil, err
+			}
+			return toStarlark(e.query(eventType, group, time.Duration(since)*time.Second))
+		}),
+		"now": starlark.NewBuiltin("now", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+				return nil, err
+			}
+			return toStarlark(e.localNow())
+		}),
+		"set_ac": starlark.NewBuiltin("set_ac", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var power, mode string
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "power", &power, "mode", &mode); err != nil {
+				return nil, err
+			}
+			if pause, ok := a.Paused(ScheduleTargetAC); ok {
+				log.Info("AC changed manually, script not setting AC", "until", pause.Until)
+				return starlark.None, nil
+			}
+			log.Info("script setting AC", "power", power, "mode", mode)
+			return starlark.None, a.SetACState(power, mode)
+		}),
+		"set_group": starlark.NewBuiltin("set_group", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var change GroupChange
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "group", &change.Group, "power?", &change.Power, "setpoint?", &change.TargetSetpoint, "percentage?", &change.OpenPercentage); err != nil {
+				return nil, err
+			}
+			if pause, ok := a.Paused(change.Group); ok {
+				log.Info("group changed manually, script not setting group", "group", change.Group, "until", pause.Until)
+				return starlark.None, nil
+			}
+			log.Info("script setting group", "change", change)
+			return starlark.None, a.SetGroups([]GroupChange{change})
+		}),
+		"log": starlark.NewBuiltin("log", func(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var msg string
+			if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "msg", &msg); err != nil {
+				return nil, err
+			}
+			log.Info(msg)
+			return starlark.None, nil
+		}),
+	}
+}
+
+// query returns the recorded events and group activity matching a type and group, within since of
+// now, oldest first.
+func (e *ScriptEngine) query(eventType string, group string, since time.Duration) []map[string]any {
+	e.mu.Lock()
+	e.loadHistory()
+	events := append([]Event(nil), e.history...)
+	e.mu.Unlock()
+
+	if eventType == "" || eventType == scriptActivity {
+		events = append(events, e.activity()...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+
+	var matches []map[string]any
+
+	for _, event := range events {
+		if eventType != "" && event.Type != eventType {
+			continue
+		}
+
+		if group != "" && !e.AirTouch.groupMatches(group, Group{Number: event.Group, Name: event.GroupName}) {
+			continue
+		}
+
+		if since > 0 && event.Time.Before(e.clock().Add(-since)) {
+			continue
+		}
+
+		matches = append(matches, eventJSON(event))
+	}
+
+	return matches
+}
+
+// activity reads the On and Off records GenerateGroupStatistics made for each group today.
+func (e *ScriptEngine) activity() []Event {
+	a := e.AirTouch
+
+	var events []Event
+
+	for _, g := range a.Groups {
+		value, err := a.ReadStringFromFile(activityFile(g.Name))
+		if err != nil {
+			continue
+		}
+
+		for _, line := range strings.Split(strings.TrimSpace(value), "\n") {
+			state, stamp, found := strings.Cut(line, ",")
+			if !found {
+				continue
+			}
+
+			at, err := time.Parse(time.RFC3339, stamp)
+			if err != nil {
+				continue
+			}
+
+			events = append(events, Event{Type: scriptActivity, Group: g.Number, GroupName: g.Name, New: state, Time: at})
+		}
+	}
+
+	return events
+}
+
+// loadHistory reads the events kept by an earlier run, once. e.mu must be held.
+func (e *ScriptEngine) loadHistory() {
+	if e.historyLoaded {
+		return
+	}
+	e.historyLoaded = true
+
+	if e.AirTouch.RootTempDir == "" {
+		return
+	}
+
+	value, err := e.AirTouch.ReadStringFromFile(scriptHistoryFile)
+	if err != nil {
+		return
+	}
+
+	var history []Event
+	err = json.Unmarshal([]byte(value), &history)
+	if err != nil {
+		e.AirTouch.logger().Warn("ignoring unreadable script history", "error", err)
+		return
+	}
+
+	e.history = append(history, e.history...)
+}
+
+// saveHistory persists the events. e.mu must be held.
+func (e *ScriptEngine) saveHistory() {
+	if e.AirTouch.RootTempDir == "" {
+		return
+	}
+
+	data, err := json.Marshal(e.history)
+	if err == nil {
+		err = e.AirTouch.WriteValueToFile(scriptHistoryFile, string(data))
+	}
+
+	if err != nil {
+		e.AirTouch.logger().Warn("unable to save script history", "error", err)
+	}
+}
+
+// localNow returns the parts of the current time in Timezone scripts use.
+func (e *ScriptEngine) localNow() map[string]any {
+	now := e.clock()
+
+	loc, err := time.LoadLocation(e.AirTouch.Timezone)
+	if err == nil {
+		now = now.In(loc)
+	}
+
+	return map[string]any{
+		"year":    now.Year(),
+		"month":   int(now.Month()),
+		"day":     now.Day(),
+		"hour":    now.Hour(),
+		"minute":  now.Minute(),
+		"weekday": now.Weekday().String(),
+		"unix":    now.Unix(),
+	}
+}
+
+// eventJSON describes an event with the same names scripts see.
+func eventJSON(event Event) map[string]any {
+	return map[string]any{
+		"type":       event.Type,
+		"group":      event.Group,
+		"group_name": event.GroupName,
+		"old":        event.Old,
+		"new":        event.New,
+		"time":       event.Time.Unix(),
+	}
+}
+
+// toStarlark converts a value to Starlark through its JSON encoding.
+func toStarlark(value any) (starlark.Value, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	decode := starlarkjson.Module.Members["decode"]
+
+	return starlark.Call(&starlark.Thread{Name: "convert"}, decode, starlark.Tuple{starlark.String(data)}, nil)
+}
+
+// interval returns Interval or its default.
+func (e *ScriptEngine) interval() time.Duration {
+	if e.Interval == 0 {
+		return time.Minute
+	}
+
+	return e.Interval
+}
+
+// clock returns the current time.
+func (e *ScriptEngine) clock() time.Time {
+	if e.now != nil {
+		return e.now()
+	}
+
+	return time.Now()
+}
@@ -0,0 +1,218 @@
+package airtouch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeScript writes a script into dir.
+func writeScript(t *testing.T, dir string, name string, src string) {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScriptTimer(t *testing.T) {
+	var controls [][]byte
+	a := fakeConsole(t, func(request []byte) []byte {
+		switch request[5] {
+		case 0x1f:
+			return replyFrame(0x1f, groupNameSeed)
+		case 0x2a:
+			controls = append(controls, request)
+			return groupStatusReply
+		case 0x2b:
+			return groupStatusReply
+		}
+		return acStatusReply
+	})
+	a.Confirmation = ConfirmNone
+	a.Timezone = "UTC"
+
+	dir := t.TempDir()
+	writeScript(t, dir, "bedtime.star", `
+INTERVAL = 300
+
+def on_timer():
+    living = [g for g in snapshot()["groups"] if g["name"] == "Living"][0]
+    if now()["hour"] >= 21 and living["temperature"] > 23:
+        log("cooling the living room")
+        set_group("Living", setpoint="22")
+`)
+
+	now := time.Date(2024, 1, 1, 20, 0, 0, 0, time.UTC)
+	e := ScriptEngine{AirTouch: a, Dir: dir, now: func() time.Time { return now }}
+
+	if err := e.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Tick(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(controls) != 0 {
+		t.Errorf("expected nothing before 9pm, got %d control messages", len(controls))
+	}
+
+	// Within the interval, nothing runs.
+	now = now.Add(2 * time.Minute)
+	if err := e.Tick(); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Hour)
+	if err := e.Tick(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(controls) != 1 {
+		t.Fatalf("expected the living room to be set after 9pm, got %d control messages", len(controls))
+	}
+
+	if status := e.Status(); len(status) != 1 || status[0].Name != "bedtime" || status[0].Runs != 2 || status[0].LastError != "" {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestScriptEvents(t *testing.T) {
+	a := &AirTouch{}
+
+	dir := t.TempDir()
+	writeScript(t, dir, "count.star", `
+EVENTS = ["ACMode"]
+
+def on_event(event):
+    if len(history(type="ACMode")) > 1:
+        fail("seen %s, last was %s" % (len(history()), event["new"]))
+`)
+
+	e := ScriptEngine{AirTouch: a, Dir: dir}
+	if err := e.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.HandleEvent(Event{Type: EventACMode, Old: "Cool", New: "Fan", Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.HandleEvent(Event{Type: EventACPower, Old: "On", New: "Off", Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := e.HandleEvent(Event{Type: EventACMode, Old: "Fan", New: "Cool", Time: time.Now()})
+	if err == nil || !strings.Contains(err.Error(), "seen 3, last was Cool") {
+		t.Errorf("expected the script to see the history, got %v", err)
+	}
+
+	if status := e.Status(); status[0].Runs != 2 || status[0].LastError == "" {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestScriptSandbox(t *testing.T) {
+	a := &AirTouch{}
+
+	tests := map[string]string{
+		"spin.star": `
+def on_timer():
+    for i in range(1000000000):
+        pass
+`,
+		"load.star": `
+load("os.star", "remove")
+
+def on_timer():
+    pass
+`,
+		"empty.star":    `x = 1`,
+		"interval.star": "INTERVAL = -1\ndef on_timer():\n    pass\n",
+	}
+
+	dir := t.TempDir()
+	for name, src := range tests {
+		writeScript(t, dir, name, src)
+	}
+
+	e := ScriptEngine{AirTouch: a, Dir: dir, Budget: 50 * time.Millisecond}
+
+	err := e.Load()
+	for _, name := range []string{"load", "empty", "interval"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("expected %s to fail to load, got %v", name, err)
+		}
+	}
+
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("expected ErrValidation, got %v", err)
+	}
+
+	scripts := e.loaded()
+	if len(scripts) != 1 || scripts[0].name != "spin" {
+		t.Fatalf("expected only spin to load, got %d scripts", len(scripts))
+	}
+
+	if err := e.call(scripts[0], "on_timer"); err == nil || !strings.Contains(err.Error(), "budget") {
+		t.Errorf("expected the budget to stop the script, got %v", err)
+	}
+}
+
+func TestScriptHistoryPersists(t *testing.T) {
+	a := &AirTouch{RootTempDir: t.TempDir(), Groups: []Group{{Number: 1, Name: "Bed"}}}
+	now := time.Now()
+
+	dir := t.TempDir()
+	writeScript(t, dir, "history.star", `
+def on_timer():
+    seen = history(type="ACMode")
+    activity = history(type="GroupActivity", group="Bed")
+    if len(seen) != 1 or seen[0]["new"] != "Cool" or len(activity) != 2 or activity[1]["new"] != "Off":
+        fail("history %s, activity %s" % (seen, activity))
+`)
+
+	e := ScriptEngine{AirTouch: a, Dir: dir}
+	if err := e.HandleEvent(Event{Type: EventACMode, Old: "Fan", New: "Cool", Time: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	activity := fmt.Sprintf("On,%s\nOff,%s\n", now.Add(-time.Hour).Format(time.RFC3339), now.Format(time.RFC3339))
+	if err := a.WriteValueToFile(activityFile("Bed"), activity); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted engine sees the events the last one handled.
+	restarted := ScriptEngine{AirTouch: a, Dir: dir}
+	if err := restarted.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := restarted.loaded()[0]
+	if err := restarted.call(s, "on_timer"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScriptEventsContinueAfterConversionFailure(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"first.star", "second.star"} {
+		writeScript(t, dir, name, `
+def on_event(event):
+    pass
+`)
+	}
+
+	e := ScriptEngine{AirTouch: &AirTouch{}, Dir: dir}
+	if err := e.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := e.HandleEvent(Event{Type: EventACMode, Old: make(chan int), Time: time.Now()})
+	if err == nil || !strings.Contains(err.Error(), "script first") || !strings.Contains(err.Error(), "script second") {
+		t.Errorf("expected both scripts' errors, got %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package airtouch
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// SnapshotVersion is the version of the snapshot JSON schema. It is incremented whenever a field
+// is removed or changes meaning; new optional fields do not change it.
+const SnapshotVersion = 1
+
+// SnapshotSchema is the JSON schema describing Snapshot, see schema/snapshot.schema.json.
+//
+//go:embed schema/snapshot.schema.json
+var SnapshotSchema []byte
+
+// Snapshot is the stable JSON representation of the console, its ACs and groups at a point in
+// time. It is the format to share state between services.
+type Snapshot struct {
+	Version   int             `json:"version"`
+	Timestamp time.Time       `json:"timestamp"`
+	Console   SnapshotConsole `json:"console"`
+	ACs       []SnapshotAC    `json:"acs"`
+	Groups    []SnapshotGroup `json:"groups"`
+	// Pauses lists the targets automations leave alone after a manual change.
+	Pauses []SnapshotPause `json:"pauses,omitempty"`
+}
+
+// SnapshotConsole describes the console the snapshot was taken from.
+type SnapshotConsole struct {
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+	Timezone string `json:"timezone"`
+}
+
+// SnapshotAC is the state of a single AC.
+type SnapshotAC struct {
+	Number         int     `json:"number"`
+	Power          string  `json:"power"`
+	Mode           string  `json:"mode"`
+	FanSpeed       string  `json:"fan_speed,omitempty"`
+	TargetSetpoint int     `json:"target_setpoint"`
+	Temperature    float64 `json:"temperature"`
+	Spill          bool    `json:"spill"`
+}
+
+// SnapshotGroup is the state of a single group. OpenPercentage has already been corrected for
+// groups that are off and for spill groups.
+type SnapshotGroup struct {
+	Number         int    `json:"number"`
+	Name           string `json:"name"`
+	Power          string `json:"power"`
+	ControlMethod  string `json:"control_method"`
+	OpenPercentage int    `json:"open_percentage"`
+	// ReportedPercentage is the percentage the console reports, before the spill correction.
+	// It is the value to set to put the group back, and is nil in snapshots taken without it.
+	ReportedPercentage *int                    `json:"reported_percentage,omitempty"`
+	TargetSetpoint     int                     `json:"target_setpoint"`
+	Temperature        *float64                `json:"temperature"`
+	Spill              bool                    `json:"spill"`
+	BatteryLow         bool                    `json:"battery_low"`
+	TurboSupport       bool                    `json:"turbo_support"`
+	Statistics         SnapshotGroupStatistics `json:"statistics"`
+}
+
+// SnapshotPause is automation paused on the AC or a group after a manual change.
+type SnapshotPause struct {
+	// Target is AC or a group number.
+	Target string    `json:"target"`
+	Name   string    `json:"name"`
+	Field  string    `json:"field"`
+	Old    string    `json:"old"`
+	New    string    `json:"new"`
+	Until  time.Time `json:"until"`
+}
+
+// SnapshotGroupStatistics holds values derived from a group's history.
+type SnapshotGroupStatistics struct {
+	DayDurationMinutes float64 `json:"day_duration_minutes"`
+}
+
+// Snapshot returns the current AC and group state in the stable JSON representation.
+func (a *AirTouch) Snapshot() Snapshot {
+	snapshot := Snapshot{
+		Version:   SnapshotVersion,
+		Timestamp: time.Now().UTC(),
+		Console: SnapshotConsole{
+			Address:  a.IPAddress,
+			Port:     a.Port,
+			Timezone: a.Timezone,
+		},
+		ACs:    []SnapshotAC{},
+		Groups: []SnapshotGroup{},
+	}
+
+	if a.AC.PowerState != "" {
+		snapshot.ACs = append(snapshot.ACs, SnapshotAC{
+			Number:         0,
+			Power:          a.AC.PowerState,
+			Mode:           a.AC.AcMode,
+			FanSpeed:       a.AC.AcFanSpeed,
+			TargetSetpoint: a.AC.AcTargetSetpoint,
+			Temperature:    a.AC.Temperature,
+			Spill:          a.AC.Spill,
+		})
+	}
+
+	for _, g := range a.Groups {
+		reported := g.OpenPercentage
+		group := SnapshotGroup{
+			Number:             g.Number,
+			Name:               g.Name,
+			Power:              g.PowerState,
+			ControlMethod:      g.ControlMethod,
+			OpenPercentage:     g.OpenPercentage,
+			ReportedPercentage: &reported,
+			TargetSetpoint:     g.TargetSetpoint,
+			Spill:              g.Spill,
+			BatteryLow:         g.BatteryLow,
+			TurboSupport:       g.TurboSupport,
+			Statistics: SnapshotGroupStatistics{
+				DayDurationMinutes: g.DayDurationMinutes,
+			},
+		}
+
+		// FixOpenPercentages puts the corrected value for spill groups in SpillPercentage.
+		if g.Spill {
+			group.OpenPercentage = g.SpillPercentage
+		}
+
+		if g.Sensor {
+			temperature := g.Temperature
+			group.Temperature = &temperature
+		}
+
+		snapshot.Groups = append(snapshot.Groups, group)
+	}
+
+	for _, pause := range a.Pauses() {
+		snapshot.Pauses = append(snapshot.Pauses, SnapshotPause(pause))
+	}
+
+	return snapshot
+}
+
+// UnmarshalJSON decodes a snapshot, rejecting versions this package does not understand.
+func (s *Snapshot) UnmarshalJSON(data []byte) error {
+	type snapshot Snapshot
+
+	var decoded snapshot
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return err
+	}
+
+	if decoded.Version != SnapshotVersion {
+		return &ValidationError{Field: "version", Value: fmt.Sprint(decoded.Version), Reason: fmt.Sprintf("only version %d is supported", SnapshotVersion)}
+	}
+
+	*s = Snapshot(decoded)
+
+	return nil
+}
+
+// DesiredState returns the state that puts the AC and groups back as they are in the snapshot.
+// Groups are matched by number.
+func (s Snapshot) DesiredState() DesiredState {
+	var desired DesiredState
+
+	if len(s.ACs) > 0 {
+		desired.ACPower = s.ACs[0].Power
+		desired.ACMode = s.ACs[0].Mode
+		desired.ACFanSpeed = s.ACs[0].FanSpeed
+		desired.ACTargetSetpoint = strconv.Itoa(s.ACs[0].TargetSetpoint)
+	}
+
+	for _, g := range s.Groups {
+		change := GroupChange{Group: strconv.Itoa(g.Number), Power: g.Power}
+
+		if g.ControlMethod == "TemperatureControl" {
+			change.TargetSetpoint = strconv.Itoa(g.TargetSetpoint)
+		} else if percentage, ok := g.setPercentage(); ok {
+			change.OpenPercentage = strconv.Itoa(percentage)
+		}
+
+		desired.Groups = append(desired.Groups, change)
+	}
+
+	return desired
+}
+
+// setPercentage returns the percentage that puts a group back. The spill corrected percentage
+// can't be set, so it returns false for spill groups in snapshots without ReportedPercentage.
+func (g SnapshotGroup) setPercentage() (int, bool) {
+	if !g.Spill {
+		return g.OpenPercentage, true
+	}
+
+	if g.ReportedPercentage == nil {
+		return 0, false
+	}
+
+	return *g.ReportedPercentage, true
+}
@@ -0,0 +1,119 @@
+package airtouch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestSnapshotMatchesSchema(t *testing.T) {
+	a := AirTouch{IPAddress: "192.168.1.20", Port: 9004, Timezone: "Australia/Sydney"}
+
+	if err := a.DecodeGroupStatusMessage(MessageOutput{Body: groupStatusSeed}); err != nil {
+		t.Fatal(err)
+	}
+	a.FixOpenPercentages()
+
+	if err := a.DecodeACStatusMessage(MessageOutput{Body: acStatusSeed}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := json.Marshal(a.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var snapshot map[string]any
+	if err := json.Unmarshal(content, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	var schema struct {
+		Required []string
+		Defs     map[string]struct{ Required []string } `json:"$defs"`
+	}
+	if err := json.Unmarshal(SnapshotSchema, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	requireKeys := func(name string, object any, required []string) {
+		for _, key := range required {
+			if _, ok := object.(map[string]any)[key]; !ok {
+				t.Errorf("%s is missing required %q", name, key)
+			}
+		}
+	}
+
+	requireKeys("snapshot", snapshot, schema.Required)
+	requireKeys("ac", snapshot["acs"].([]any)[0], schema.Defs["ac"].Required)
+
+	for _, group := range snapshot["groups"].([]any) {
+		requireKeys("group", group, schema.Defs["group"].Required)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	a := AirTouch{}
+
+	// Make the last group a spill group.
+	body := append([]byte{}, groupStatusSeed...)
+	body[23] |= 0x10
+
+	if err := a.DecodeGroupStatusMessage(MessageOutput{Body: body}); err != nil {
+		t.Fatal(err)
+	}
+	a.FixOpenPercentages()
+
+	expected := a.Snapshot()
+
+	content, err := json.Marshal(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Snapshot
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+
+	// The spill group's corrected percentage replaces its reported one.
+	if got.Groups[3].OpenPercentage != a.Groups[3].SpillPercentage {
+		t.Errorf("expected spill group open percentage %d, got %d", a.Groups[3].SpillPercentage, got.Groups[3].OpenPercentage)
+	}
+
+	// Restoring the spill group sets the percentage it reported.
+	desired := got.DesiredState()
+	if desired.Groups[3].OpenPercentage != strconv.Itoa(a.Groups[3].OpenPercentage) {
+		t.Errorf("expected the reported percentage %d to be restored, got %s", a.Groups[3].OpenPercentage, desired.Groups[3].OpenPercentage)
+	}
+
+	// Snapshots without the reported percentage leave the spill group's percentage alone.
+	got.Groups[3].ReportedPercentage = nil
+	if desired := got.DesiredState(); desired.Groups[3].OpenPercentage != "" || desired.Groups[3].Power == "" {
+		t.Errorf("expected only the spill group's power to be restored, got %+v", desired.Groups[3])
+	}
+
+	scene := SceneFromSnapshot("spill", expected)
+	if scene.Groups[3].OpenPercentage == nil || *scene.Groups[3].OpenPercentage != a.Groups[3].OpenPercentage {
+		t.Errorf("expected the scene to keep the reported percentage %d, got %v", a.Groups[3].OpenPercentage, scene.Groups[3].OpenPercentage)
+	}
+
+	if scene := SceneFromSnapshot("spill", got); scene.Groups[3].OpenPercentage != nil {
+		t.Errorf("expected no percentage without the reported one, got %d", *scene.Groups[3].OpenPercentage)
+	}
+}
+
+func TestSnapshotVersion(t *testing.T) {
+	var snapshot Snapshot
+
+	err := json.Unmarshal([]byte(`{"version": 2}`), &snapshot)
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("expected ErrValidation, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package airtouch
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// SolarSunrise is when the top of the sun rises above the horizon.
+	SolarSunrise = "Sunrise"
+	// SolarSunset is when the top of the sun sets below the horizon.
+	SolarSunset = "Sunset"
+	// SolarNoon is when the sun is highest.
+	SolarNoon = "SolarNoon"
+)
+
+// SolarEventMap lists the solar events a ScheduleEntry can run relative to.
+func (a *AirTouch) SolarEventMap() map[string]bool {
+	return map[string]bool{
+		SolarSunrise: true,
+		SolarSunset:  true,
+		SolarNoon:    true,
+	}
+}
+
+// SolarTime returns when a solar event happens on the local day of date at Latitude and
+// Longitude. It returns false on days the sun doesn't rise or set, such as polar summers and
+// winters.
+func (a *AirTouch) SolarTime(event string, date time.Time) (time.Time, bool) {
+	sunrise, noon, sunset, ok := solarTimes(date, a.Latitude, a.Longitude)
+
+	switch event {
+	case SolarNoon:
+		return noon, true
+	case SolarSunrise:
+		return sunrise, ok
+	case SolarSunset:
+		return sunset, ok
+	}
+
+	return time.Time{}, false
+}
+
+// solarTimes uses the sunrise equation, which is accurate to about a minute away from the poles.
+// Longitude is positive east.
+func solarTimes(date time.Time, latitude float64, longitude float64) (time.Time, time.Time, time.Time, bool) {
+	// Days since the J2000 epoch at noon UTC on the local date.
+	noonUTC := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, time.UTC)
+	n := math.Round(julianDay(noonUTC) - 2451545.0)
+
+	meanNoon := n - longitude/360
+	anomaly := math.Mod(357.5291+0.98560028*meanNoon, 360)
+	centre := 1.9148*sin(anomaly) + 0.0200*sin(2*anomaly) + 0.0003*sin(3*anomaly)
+	eclipticLongitude := math.Mod(anomaly+centre+180+102.9372, 360)
+
+	transit := 2451545.0 + meanNoon + 0.0053*sin(anomaly) - 0.0069*sin(2*eclipticLongitude)
+	declination := math.Asin(sin(eclipticLongitude) * sin(23.4397))
+
+	// -0.833 degrees allows for refraction and the radius of the sun.
+	cosHourAngle := (sin(-0.833) - sin(latitude)*math.Sin(declination)) / (cos(latitude) * math.Cos(declination))
+	noon := fromJulianDay(transit)
+
+	if cosHourAngle < -1 || cosHourAngle > 1 {
+		return time.Time{}, noon, time.Time{}, false
+	}
+
+	hourAngle := math.Acos(cosHourAngle) * 180 / math.Pi
+
+	return fromJulianDay(transit - hourAngle/360), noon, fromJulianDay(transit + hourAngle/360), true
+}
+
+// julianDay converts a time to a Julian day.
+func julianDay(t time.Time) float64 {
+	return float64(t.Unix())/86400 + 2440587.5
+}
+
+// fromJulianDay converts a Julian day to a UTC time.
+func fromJulianDay(day float64) time.Time {
+	return time.Unix(0, int64((day-2440587.5)*86400*float64(time.Second))).UTC().Round(time.Second)
+}
+
+// sin takes degrees.
+func sin(degrees float64) float64 {
+	return math.Sin(degrees * math.Pi / 180)
+}
+
+// cos takes degrees.
+func cos(degrees float64) float64 {
+	return math.Cos(degrees * math.Pi / 180)
+}
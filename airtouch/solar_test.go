@@ -0,0 +1,92 @@
+package airtouch
+
+import (
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestSolarTime(t *testing.T) {
+	sydney, _ := time.LoadLocation("Australia/Sydney")
+	london, _ := time.LoadLocation("Europe/London")
+
+	tests := []struct {
+		name      string
+		latitude  float64
+		longitude float64
+		event     string
+		date      time.Time
+		expected  time.Time
+		ok        bool
+	}{
+		{"Sydney sunrise", -33.87, 151.21, SolarSunrise, time.Date(2024, 7, 1, 0, 0, 0, 0, sydney), time.Date(2024, 7, 1, 7, 1, 0, 0, sydney), true},
+		{"Sydney noon", -33.87, 151.21, SolarNoon, time.Date(2024, 7, 1, 0, 0, 0, 0, sydney), time.Date(2024, 7, 1, 11, 59, 0, 0, sydney), true},
+		{"Sydney sunset", -33.87, 151.21, SolarSunset, time.Date(2024, 7, 1, 0, 0, 0, 0, sydney), time.Date(2024, 7, 1, 16, 57, 0, 0, sydney), true},
+		{"Sydney summer sunset", -33.87, 151.21, SolarSunset, time.Date(2024, 12, 21, 0, 0, 0, 0, sydney), time.Date(2024, 12, 21, 20, 5, 0, 0, sydney), true},
+		{"London sunrise", 51.51, -0.13, SolarSunrise, time.Date(2024, 6, 21, 0, 0, 0, 0, london), time.Date(2024, 6, 21, 4, 43, 0, 0, london), true},
+		{"London sunset", 51.51, -0.13, SolarSunset, time.Date(2024, 6, 21, 0, 0, 0, 0, london), time.Date(2024, 6, 21, 21, 21, 0, 0, london), true},
+		{"Tromsø midnight sun", 69.65, 18.96, SolarSunset, time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC), time.Time{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &AirTouch{Latitude: test.latitude, Longitude: test.longitude}
+
+			at, ok := a.SolarTime(test.event, test.date)
+			if ok != test.ok {
+				t.Fatalf("expected ok %v, got %v", test.ok, ok)
+			}
+
+			if ok && (at.Sub(test.expected) > 2*time.Minute || test.expected.Sub(at) > 2*time.Minute) {
+				t.Errorf("expected about %v, got %v", test.expected, at.In(test.expected.Location()))
+			}
+		})
+	}
+}
+
+func TestSolarSchedule(t *testing.T) {
+	a := &AirTouch{Latitude: -33.87, Longitude: 151.21}
+	loc, _ := time.LoadLocation("Australia/Sydney")
+
+	program := Program{Target: "West", Entries: []ScheduleEntry{
+		{Solar: SolarSunset, Offset: -2 * time.Hour, Power: "Off"},
+		{At: "08:00", Power: "On"},
+	}}
+
+	// Two hours before sunset moves through the year.
+	for _, test := range []struct {
+		now      time.Time
+		expected time.Time
+	}{
+		{time.Date(2024, 7, 1, 12, 0, 0, 0, loc), time.Date(2024, 7, 1, 14, 57, 0, 0, loc)},
+		{time.Date(2024, 12, 21, 12, 0, 0, 0, loc), time.Date(2024, 12, 21, 18, 5, 0, 0, loc)},
+	} {
+		next, ok := a.nextEntry(program, test.now, loc)
+		if !ok || next.Sub(test.expected) > 2*time.Minute || test.expected.Sub(next) > 2*time.Minute {
+			t.Errorf("expected about %v, got %v", test.expected, next.In(loc))
+		}
+	}
+
+	s := Scheduler{AirTouch: a}
+	if err := s.SetPrograms([]Program{program}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range []ScheduleEntry{
+		{Solar: "Dusk"},
+		{Solar: SolarSunset, At: "18:00"},
+		{At: "18:00", Offset: time.Hour},
+	} {
+		err := s.SetPrograms([]Program{{Target: "0", Entries: []ScheduleEntry{entry}}})
+		if !errors.Is(err, ErrValidation) {
+			t.Errorf("%+v: expected ErrValidation, got %v", entry, err)
+		}
+	}
+
+	// Solar entries need to know where the house is.
+	s.AirTouch = &AirTouch{}
+	if err := s.SetPrograms([]Program{program}); !errors.Is(err, ErrValidation) {
+		t.Errorf("expected ErrValidation without a location, got %v", err)
+	}
+}
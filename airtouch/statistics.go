@@ -3,7 +3,6 @@ package airtouch
 import (
 	"bufio"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,30 +18,33 @@ func (a *AirTouch) GenerateGroupStatistics() error {
 
 	timeToResetFiles, _ := a.EndOfDay()
 	if timeToResetFiles {
-		log.Printf("Removing airtouch group activity files")
+		a.logger().Info("removing airtouch group activity files")
 		files, err := filepath.Glob(fmt.Sprintf("%s/%s", a.RootTempDir, "airtouch_*"))
 		if err != nil {
 			return err
 		}
 
 		for _, f := range files {
-			log.Printf("Removing %s...", f)
+			a.logger().Debug("removing group activity file", "file", f)
 			if err := os.Remove(f); err != nil {
 				return err
 			}
 		}
 	}
 
+	config := a.CurrentPatchConfig()
+
 	for i, g := range a.Groups {
-		filename := fmt.Sprintf("airtouch_%s_activity", g.Name)
+		filename := activityFile(g.Name)
 
 		// Room requires heating/cooling.
-		// Needs to be above 50 as that is the default on percentage from Fan -> Heat/Cool.
+		// Needs to be above the active open percentage, 50 by default as that is the default on percentage from
+		// the fallback mode -> Heat/Cool.
 		// When that transition happens, we don't want to record that there is active heating/cooling occurring.
-		if a.AC.AcMode != "Fan" && g.PowerState == "On" && g.OpenPercentage > 50 {
+		if a.AC.AcMode != config.FallbackMode && g.PowerState == "On" && g.OpenPercentage > config.ActiveOpenPercentage {
 			err = a.AppendValueToFile(filename, fmt.Sprintf("%s,%s\n", g.PowerState, localTime.Format(time.RFC3339)))
 			if err != nil {
-				log.Printf("Unable to write group activity to file, please correct, skipping statistics")
+				a.logger().Warn("unable to write group activity to file, please correct, skipping statistics", "error", err)
 				return err
 			}
 		} else {
@@ -51,7 +53,7 @@ func (a *AirTouch) GenerateGroupStatistics() error {
 			// the minimum vent percentage is stopping the vent from fully closing.
 			err = a.AppendValueToFile(filename, fmt.Sprintf("%s,%s\n", "Off", localTime.Format(time.RFC3339)))
 			if err != nil {
-				log.Printf("Unable to write group activity to file, please correct, skipping statistics")
+				a.logger().Warn("unable to write group activity to file, please correct, skipping statistics", "error", err)
 				return err
 			}
 		}
@@ -74,8 +76,6 @@ func (a *AirTouch) GenerateGroupStatistics() error {
 		// https://golang.org/pkg/bufio/#Scanner.Scan
 		foundOnBlock := false
 		foundOffBlock := false
-		//a.Log.Debug("working with %s", g.Name)
-		//a.Log.Debug("-------------------------------------------------")
 		for scanner.Scan() {
 
 			line := strings.Split(scanner.Text(), ",")
@@ -83,14 +83,12 @@ func (a *AirTouch) GenerateGroupStatistics() error {
 			timeStamp := line[1]
 
 			if !foundOnBlock && state == "On" {
-				//a.Log.Debug("found On block %s", timeStamp)
 				startTime, err = time.Parse("2006-01-02T15:04:05Z07:00", timeStamp)
 				if err != nil {
 					return err
 				}
 				foundOnBlock = true
 			} else if foundOnBlock && !foundOffBlock && state == "Off" {
-				//a.Log.Debug("found Off block %s", timeStamp)
 				endTime, err = time.Parse("2006-01-02T15:04:05Z07:00", timeStamp)
 				if err != nil {
 					return err
@@ -100,7 +98,6 @@ func (a *AirTouch) GenerateGroupStatistics() error {
 
 			if foundOnBlock && foundOffBlock {
 				duration = endTime.Sub(startTime).Minutes()
-				//a.Log.Debug("duration of this block is %f minutes", duration)
 				durationTotalMins += duration
 				foundOnBlock = false
 				foundOffBlock = false
@@ -110,12 +107,16 @@ func (a *AirTouch) GenerateGroupStatistics() error {
 		// Group hasn't been Off yet
 		if foundOnBlock && !foundOffBlock {
 			durationTotalMins += time.Since(startTime).Minutes()
-			//a.Log.Debug("didn't found an Off block so assuming this has always been on")
 		}
 
 		a.Groups[i].DayDurationMinutes = durationTotalMins
-		log.Printf("%s has been On for %f minutes today", a.Groups[i].Name, a.Groups[i].DayDurationMinutes)
+		a.logger().Debug("group duration on today", "group", a.Groups[i].Name, "minutes", a.Groups[i].DayDurationMinutes)
 	}
 
 	return nil
 }
+
+// activityFile is the file a group's activity for the day is recorded in.
+func activityFile(name string) string {
+	return fmt.Sprintf("airtouch_%s_activity", name)
+}
@@ -0,0 +1,37 @@
+package airtouch
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGroupStatisticsFallbackMode(t *testing.T) {
+	a := AirTouch{RootTempDir: t.TempDir(), Timezone: "UTC"}
+
+	config := DefaultPatchConfig()
+	config.AllowedModes = []string{"Cool", "Heat"}
+	config.FallbackMode = "Dry"
+	if err := a.SetPatchConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	a.Groups = []Group{{Name: "Living", PowerState: "On", OpenPercentage: 80}}
+
+	for _, mode := range []string{"Dry", "Fan"} {
+		a.AC.AcMode = mode
+		if err := a.GenerateGroupStatistics(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	activity, err := a.ReadStringFromFile("airtouch_Living_activity")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The group isn't active in the fallback mode, but is in fan mode when that isn't the fallback.
+	lines := strings.Split(strings.TrimSpace(activity), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "Off,") || !strings.HasPrefix(lines[1], "On,") {
+		t.Errorf("expected the group to be off in the fallback mode only, got %q", activity)
+	}
+}
@@ -1,8 +1,15 @@
 module github.com/alistairpialek/airtouch4-go
 
-go 1.19
+go 1.21
 
 require (
+	github.com/apognu/gocal v0.9.1
 	github.com/elliotchance/orderedmap v1.5.0
 	github.com/npat-efault/crc16 v0.0.0-20161013170008-4128ccbe47c3
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+)
+
+require (
+	github.com/ChannelMeter/iso8601duration v0.0.0-20150204201828-8da3af7a2a61 // indirect
+	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
 )
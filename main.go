@@ -2,6 +2,8 @@ package main
 
 import (
 	"log"
+	"log/slog"
+	"os"
 
 	"github.com/alistairpialek/airtouch4-go/airtouch"
 )
@@ -13,6 +15,7 @@ func main() {
 		RootTempDir:      "/tmp",
 		Timezone:         "Australia/Sydney",
 		ReportLoopPeriod: 60,
+		Log:              slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo})),
 	}
 
 	err := a.GetGroupData()